@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 配置中支持的引用：${NAME} 环境变量，未设置时报错；${NAME:-default} 未设置或者为空时使用默认值；
+// ${file:path} 文件的内容；${secret:name} secrets_dir 目录(默认 /run/secrets)下同名文件的内容；
+// $${ 原样保留为 ${
+var (
+	reference = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	envName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Expand 替换字符串中的引用，只用于解析后的字符串值，替换的结果不会再作为配置解析
+func Expand(s string) (string, error) {
+	var err error
+	result := reference.ReplaceAllStringFunc(s, func(m string) string {
+		if err != nil {
+			return m
+		}
+		if m == "$${" {
+			return "${"
+		}
+
+		var v string
+		v, err = resolve(m[2 : len(m)-1])
+		return v
+	})
+
+	return result, err
+}
+
+func resolve(ref string) (string, error) {
+	if strings.HasPrefix(ref, "file:") {
+		return readValue(strings.TrimPrefix(ref, "file:"))
+	}
+
+	if strings.HasPrefix(ref, "secret:") {
+		name := strings.TrimPrefix(ref, "secret:")
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return "", errors.New(fmt.Sprintf("Invalid secret name %s", name))
+		}
+
+		dir := viper.GetString("secrets_dir")
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		return readValue(filepath.Join(dir, name))
+	}
+
+	name, def, hasDefault := ref, "", false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, def, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	if !envName.MatchString(name) {
+		return "", errors.New(fmt.Sprintf("Invalid reference ${%s}", ref))
+	}
+
+	v, found := os.LookupEnv(name)
+	if hasDefault && v == "" {
+		return def, nil
+	}
+	if !found {
+		return "", errors.New(fmt.Sprintf("Environment variable %s is not set", name))
+	}
+	return v, nil
+}
+
+// readValue 读取文件内容作为值，去掉末尾的换行
+func readValue(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
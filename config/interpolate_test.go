@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "interpolate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "password"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("secrets_dir", dir)
+	defer viper.Set("secrets_dir", "")
+
+	os.Setenv("JOBBER_TEST_SET", "value")
+	os.Setenv("JOBBER_TEST_EMPTY", "")
+	os.Unsetenv("JOBBER_TEST_UNSET")
+	defer os.Unsetenv("JOBBER_TEST_SET")
+	defer os.Unsetenv("JOBBER_TEST_EMPTY")
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+		err  bool
+	}{
+		{"plain", "amqp://localhost", "amqp://localhost", false},
+		{"env", "${JOBBER_TEST_SET}", "value", false},
+		{"env in text", "http://${JOBBER_TEST_SET}/path", "http://value/path", false},
+		{"env unset", "${JOBBER_TEST_UNSET}", "", true},
+		{"env empty", "${JOBBER_TEST_EMPTY}", "", false},
+		{"default unset", "${JOBBER_TEST_UNSET:-def}", "def", false},
+		{"default empty", "${JOBBER_TEST_EMPTY:-def}", "def", false},
+		{"default set", "${JOBBER_TEST_SET:-def}", "value", false},
+		{"default empty default", "${JOBBER_TEST_UNSET:-}", "", false},
+		{"escape", "$${JOBBER_TEST_SET}", "${JOBBER_TEST_SET}", false},
+		{"escape then ref", "$${a}${JOBBER_TEST_SET}", "${a}value", false},
+		{"file", "${file:" + filepath.Join(dir, "password") + "}", "s3cret", false},
+		{"file missing", "${file:" + filepath.Join(dir, "missing") + "}", "", true},
+		{"secret", "${secret:password}", "s3cret", false},
+		{"secret missing", "${secret:missing}", "", true},
+		{"secret traversal", "${secret:../password}", "", true},
+		{"secret empty", "${secret:}", "", true},
+		{"invalid name", "${1ABC}", "", true},
+		{"invalid empty", "${}", "", true},
+		{"not a reference", "$JOBBER_TEST_SET", "$JOBBER_TEST_SET", false},
+	}
+
+	for _, c := range cases {
+		got, err := Expand(c.in)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: Expand(%q) expected error, got %q", c.name, c.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Expand(%q) unexpected error: %v", c.name, c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: Expand(%q) = %q, want %q", c.name, c.in, got, c.want)
+		}
+	}
+}
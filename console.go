@@ -6,10 +6,12 @@ import (
 	"github.com/spf13/viper"
 	"gitlab.mydadao.com/marketing/message_jobber/config"
 	"gitlab.mydadao.com/marketing/message_jobber/console"
+	"os"
 )
 
 func main() {
 	var cfg = pflag.StringP("config", "c", "", "config file path.")
+	var remote = pflag.Bool("remote", false, "check: validate the config files on the running server instead of locally.")
 
 	pflag.Parse()
 
@@ -17,6 +19,14 @@ func main() {
 		panic(err)
 	}
 
+	// check 子命令校验配置文件，默认校验本地的文件，有无效的配置文件时以非零状态退出
+	if pflag.Arg(0) == "check" {
+		if !console.Check(viper.GetString("server.addr"), *remote) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	inter := &console.Interactive{
 		ServerUrl: viper.GetString("server.addr"),
 	}
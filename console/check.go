@@ -0,0 +1,100 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.mydadao.com/marketing/message_jobber/responses"
+	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
+	"strings"
+)
+
+// Check 校验 include 下的所有 jobber 配置文件，不会应用，有无效的配置文件时返回 false，
+// 默认直接读取本地的配置文件，不需要服务在运行，remote 为 true 时让服务端校验
+func Check(serverUrl string, remote bool) bool {
+	var data []responses.ValidateResponse
+	var err error
+	if remote {
+		data, err = validate(serverUrl)
+	} else {
+		data, err = validateLocal()
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return false
+	}
+
+	str, valid := validateReport(data)
+	fmt.Println(str)
+	return valid
+}
+
+// validateLocal 按 jobber.yaml 的 include 校验本地的配置文件
+func validateLocal() ([]responses.ValidateResponse, error) {
+	reports, err := mq.Validate(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]responses.ValidateResponse, 0, len(reports))
+	for _, r := range reports {
+		issues := make([]responses.IssueResponse, 0, len(r.Issues))
+		for _, issue := range r.Issues {
+			issues = append(issues, responses.IssueResponse{
+				Line:    issue.Line,
+				Field:   issue.Field,
+				Message: issue.Message,
+			})
+		}
+
+		data = append(data, responses.ValidateResponse{
+			File:   r.File,
+			Name:   r.Name,
+			Valid:  r.Valid(),
+			Issues: issues,
+		})
+	}
+	return data, nil
+}
+
+// validate 请求服务端校验所有配置文件
+func validate(serverUrl string) ([]responses.ValidateResponse, error) {
+	res := Post("http://"+serverUrl+"/mq/validate", "application/x-yaml", nil)
+	if res.Success() == false {
+		return nil, errors.New(res.Message)
+	}
+
+	data := make([]responses.ValidateResponse, 0)
+	if err := json.Unmarshal(res.Attachment, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// validateReport 按文件输出校验结果，每个问题一行
+func validateReport(data []responses.ValidateResponse) (string, bool) {
+	if len(data) == 0 {
+		return "No config files found.", true
+	}
+
+	valid := true
+	lines := make([]string, 0, len(data))
+	for _, r := range data {
+		if r.Valid {
+			lines = append(lines, fmt.Sprintf("%s: ok", r.File))
+			continue
+		}
+
+		valid = false
+		lines = append(lines, fmt.Sprintf("%s: %d errors", r.File, len(r.Issues)))
+		for _, issue := range r.Issues {
+			if issue.Line > 0 {
+				lines = append(lines, fmt.Sprintf("\tline %d: %s", issue.Line, issue.Message))
+			} else {
+				lines = append(lines, "\t"+issue.Message)
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n"), valid
+}
@@ -3,6 +3,7 @@ package console
 import "net/http"
 import (
 	"encoding/json"
+	"io"
 	"io/ioutil"
 )
 
@@ -28,8 +29,37 @@ func (this *Response) String() string {
 }
 
 func Get(uri string) (res *Response) {
+	return Do("GET", uri, "", nil)
+}
+
+func Post(uri string, contentType string, body io.Reader) (res *Response) {
+	return Do("POST", uri, contentType, body)
+}
+
+func Put(uri string, contentType string, body io.Reader) (res *Response) {
+	return Do("PUT", uri, contentType, body)
+}
+
+func Delete(uri string) (res *Response) {
+	return Do("DELETE", uri, "", nil)
+}
+
+func Do(method string, uri string, contentType string, body io.Reader) (res *Response) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return decode(nil, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// 服务端记录配置版本时区分来自 console 的操作
+	req.Header.Set("X-Jobber-Source", "console")
+
+	return decode(http.DefaultClient.Do(req))
+}
+
+func decode(resp *http.Response, err error) (res *Response) {
 	res = new(Response)
-	resp, err := http.Get(uri)
 	if err != nil {
 		res.Code = -1
 		res.Message = err.Error()
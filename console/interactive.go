@@ -2,12 +2,19 @@ package console
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"gitlab.mydadao.com/marketing/message_jobber/responses"
+	"io/ioutil"
+	"net/url"
 	"os"
+	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Command string
@@ -23,25 +30,36 @@ const (
 	ENTER  Command = ""
 	UNKNOW Command = "unknow"
 
-	ADD      Command = "add"
-	CLEAR    Command = "clear"
-	START    Command = "start"
-	STOP     Command = "stop"
-	RESTART  Command = "restart"
-	REREAD   Command = "reread"
-	REMOVE   Command = "remove"
-	UPDATE   Command = "update"
-	RELOAD   Command = "reload"
-	SHUTDOWN Command = "shutdown"
-	STATUS   Command = "status"
-	TAIL     Command = "tail"
-	VERSION  Command = "version"
+	ADD       Command = "add"
+	EDIT      Command = "edit"
+	DELETE    Command = "delete"
+	CLEAR     Command = "clear"
+	START     Command = "start"
+	STOP      Command = "stop"
+	RESTART   Command = "restart"
+	REREAD    Command = "reread"
+	REMOVE    Command = "remove"
+	UPDATE    Command = "update"
+	RELOAD    Command = "reload"
+	PAUSE     Command = "pause"
+	RESUME    Command = "resume"
+	SCALE     Command = "scale"
+	AUTOSCALE Command = "autoscale"
+	RATELIMIT Command = "ratelimit"
+	CHECK     Command = "check"
+	HISTORY   Command = "history"
+	ROLLBACK  Command = "rollback"
+	SHUTDOWN  Command = "shutdown"
+	STATUS    Command = "status"
+	TAIL      Command = "tail"
+	VERSION   Command = "version"
+	WORKERS   Command = "workers"
 )
 
 // *** Unknown syntax: grdszx
 
 var commands = []Command{
-	EXIT, QUIT, HELP, ENTER, UNKNOW, ADD, CLEAR, START, STOP, RESTART, REREAD, REMOVE, UPDATE, RELOAD, SHUTDOWN, STATUS, TAIL, VERSION,
+	EXIT, QUIT, HELP, ENTER, UNKNOW, ADD, EDIT, DELETE, CLEAR, START, STOP, RESTART, REREAD, REMOVE, UPDATE, RELOAD, PAUSE, RESUME, SCALE, AUTOSCALE, RATELIMIT, CHECK, HISTORY, ROLLBACK, SHUTDOWN, STATUS, TAIL, VERSION, WORKERS,
 }
 
 type cmd struct {
@@ -67,7 +85,17 @@ func (this *Interactive) Run(ctx context.Context) {
 		case HELP:
 			this.help()
 		case STATUS:
-			this.status()
+			if len(cmd.data) > 0 {
+				this.statusDetail(cmd.data)
+			} else {
+				this.status()
+			}
+		case ADD:
+			this.add(cmd)
+		case EDIT:
+			this.edit(cmd)
+		case DELETE:
+			this.delete(cmd, scanner)
 		case STOP:
 			this.stop(cmd)
 		case START:
@@ -78,8 +106,32 @@ func (this *Interactive) Run(ctx context.Context) {
 			this.reread()
 		case UPDATE:
 			this.update()
+		case RELOAD:
+			this.reload(cmd)
+		case PAUSE:
+			this.pause(cmd)
+		case RESUME:
+			this.resume(cmd)
+		case SCALE:
+			this.scale(cmd)
+		case AUTOSCALE:
+			this.autoscale(cmd)
+		case RATELIMIT:
+			this.ratelimit(cmd)
+		case CLEAR:
+			this.clear(cmd)
+		case CHECK:
+			this.check()
+		case HISTORY:
+			this.history(cmd)
+		case ROLLBACK:
+			this.rollback(cmd, scanner)
+		case SHUTDOWN:
+			this.shutdown(scanner)
 		case RESTART:
 			this.restart(cmd)
+		case WORKERS:
+			this.workers(cmd, scanner)
 		default:
 			this.response("*** Unknown syntax ***")
 		}
@@ -145,8 +197,8 @@ func (this *Interactive) Exit() {
 func (this *Interactive) help() {
 	this.response(`default commands (type help <topic>):
 =====================================
-add    clear  fg        open  quit    remove  restart   start   stop  update
-avail  exit   maintail  pid   reload  reread  shutdown  status  tail  version`)
+add        avail  clear   edit  fg       maintail  pause  quit       reload  reread   resume    scale     start   stop  update   workers
+autoscale  check  delete  exit  history  open      pid    ratelimit  remove  restart  rollback  shutdown  status  tail  version`)
 }
 
 func (this *Interactive) status() {
@@ -166,48 +218,106 @@ func (this *Interactive) status() {
 		return
 	}
 
-	nameMaxLength := 0
-	queueMaxLength := 0
-	spaceNum := 4
+	rows := make([][]string, 0, len(data))
 	for _, jb := range data {
-		if len(jb.Name) > nameMaxLength {
-			nameMaxLength = len(jb.Name)
+		queue := "-"
+		if jb.InspectError == "" && jb.InspectTime != "" {
+			queue = fmt.Sprintf("ready %d, unacked %d, consumers %d", jb.Messages, jb.Unacked, jb.Consumers)
 		}
 
-		if len(jb.QueueName) > queueMaxLength {
-			queueMaxLength = len(jb.QueueName)
+		name := jb.Name
+		if jb.Group != "" && jb.Group != jb.Name {
+			name = jb.Group + ":" + jb.Name
 		}
-	}
 
-	var str string
-	for _, jb := range data {
-		var (
-			nameLength  int
-			nameNum     int
-			queueLength int
-			queueNum    int
-		)
-
-		nameLength = len(jb.Name)
-		nameNum = spaceNum + nameMaxLength - nameLength
-
-		queueLength = len(jb.QueueName)
-		queueNum = spaceNum + queueMaxLength - queueLength
-
-		str = str + fmt.Sprintf(
-			"%s%s%s%s%s%s%s",
-			jb.Name,
-			strings.Repeat(" ", nameNum),
+		workers := fmt.Sprintf("workers %d/%d", jb.BusyWorkers, jb.Workers)
+		if jb.Autoscale != nil && jb.Autoscale.Active {
+			workers += " (auto)"
+		}
+
+		status := jb.Status
+		if jb.PauseUntil != "" {
+			status += " until " + jb.PauseUntil
+		}
+		if len(jb.Intents) > 0 {
+			status += " [" + strings.Join(jb.Intents, ", ") + "]"
+		}
+
+		stats := fmt.Sprintf("%.2f/s ok %.1f%% p95 %dms", jb.Stats.Rate1m, jb.Stats.SuccessRate*100, jb.Stats.LatencyP95)
+		if jb.Stats.Processed == 0 {
+			stats = "-"
+		}
+
+		rows = append(rows, []string{
+			name,
 			jb.QueueName,
-			strings.Repeat(" ", queueNum),
-			jb.Status,
-			strings.Repeat(" ", spaceNum),
+			status,
 			jb.StatusTime,
-		)
-		str = str + "\n"
+			workers,
+			stats,
+			queue,
+		})
 	}
-	str = strings.TrimRight(str, "\n")
-	this.response(str)
+	this.response(table(rows))
+}
+
+// statusDetail 展示 jobber 的详细状态和统计
+func (this *Interactive) statusDetail(names []string) {
+	res := Get("http://" + this.ServerUrl + "/mq/status?" + nameQuery(names))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	data := make([]responses.StatusResponse, 0)
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	details := make([]string, 0, len(data))
+	for _, jb := range data {
+		status := jb.Status + " since " + jb.StatusTime
+		if jb.Uptime > 0 {
+			status += ", uptime " + (time.Duration(jb.Uptime) * time.Second).String()
+		}
+		if jb.PauseUntil != "" {
+			status += ", until " + jb.PauseUntil
+		}
+
+		workers := fmt.Sprintf("%d busy of %d", jb.BusyWorkers, jb.Workers)
+		if jb.Autoscale != nil && jb.Autoscale.Active {
+			workers += fmt.Sprintf(" (auto %d-%d)", jb.Autoscale.Min, jb.Autoscale.Max)
+		}
+
+		queue := "-"
+		if jb.InspectError != "" {
+			queue = jb.InspectError
+		} else if jb.InspectTime != "" {
+			queue = fmt.Sprintf("ready %d, unacked %d, consumers %d", jb.Messages, jb.Unacked, jb.Consumers)
+		}
+
+		s := jb.Stats
+		rows := [][]string{
+			{"\tgroup", jb.Group},
+			{"\tqueue", jb.QueueName},
+			{"\tstatus", status},
+			{"\tworkers", workers},
+			{"\tprocessed", fmt.Sprintf("%d, failed %d, success %.2f%%", s.Processed, s.Failed, s.SuccessRate*100)},
+			{"\trate", fmt.Sprintf("%.2f/s (1m), %.2f/s (5m), %.2f/s (15m)", s.Rate1m, s.Rate5m, s.Rate15m)},
+			{"\tlatency", fmt.Sprintf("p50 %dms, p95 %dms, p99 %dms", s.LatencyP50, s.LatencyP95, s.LatencyP99)},
+			{"\tlast success", s.LastSuccessTime},
+			{"\tlast error", strings.TrimSpace(s.LastErrorTime + " " + s.LastError)},
+			{"\tmessages", queue},
+		}
+		if len(jb.Intents) > 0 {
+			rows = append(rows, []string{"\tkept", strings.Join(jb.Intents, ", ")})
+		}
+
+		details = append(details, jb.Name+"\n"+table(rows))
+	}
+	this.response(strings.Join(details, "\n"))
 }
 
 func (this *Interactive) stop(c cmd) {
@@ -219,13 +329,7 @@ stop <name> <name>	Stop multiple processes or groups
 stop all		Stop all processes`)
 		return
 	}
-	name := c.data[0]
-	res := Get("http://" + this.ServerUrl + "/mq/stop?name=" + name)
-	if res.Success() == false {
-		this.response(res.Message)
-	} else {
-		this.response(res.String())
-	}
+	this.control("stop", c.data)
 }
 
 func (this *Interactive) start(c cmd) {
@@ -237,29 +341,19 @@ start <name> <name>	Start multiple processes or groups
 start all		Start all processes`)
 		return
 	}
-	name := c.data[0]
-	res := Get("http://" + this.ServerUrl + "/mq/start?name=" + name)
-	if res.Success() == false {
-		this.response(res.Message)
-	} else {
-		this.response(res.String())
-	}
+	this.control("start", c.data)
 }
 
 func (this *Interactive) remove(c cmd) {
 	if len(c.data) == 0 {
 		this.response(`Error: remove requires a jobber name
-remove <name>		Remove a jobber`)
+remove <name>		Remove a jobber
+remove <gname>:*	Remove all jobbers in a group
+remove <name> <name>	Remove multiple jobbers or groups`)
 		return
 	}
 
-	name := c.data[0]
-	res := Get("http://" + this.ServerUrl + "/mq/remove?name=" + name)
-	if res.Success() == false {
-		this.response(res.Message)
-	} else {
-		this.response(res.String())
-	}
+	this.control("remove", c.data)
 }
 
 func (this *Interactive) reread() {
@@ -278,13 +372,27 @@ func (this *Interactive) reread() {
 
 	var str string
 
+	// 每个变化的 jobber 列出 update 会应用的字段变化，新增的 jobber 没有旧配置
 	if len(data.Changes) > 0 {
-		str += "Changes: \n\t"
+		str += "Changes:\n"
 		for _, s := range data.Changes {
-			str = str + s + ", "
+			diffs, found := data.Diffs[s]
+			if !found {
+				str += "\t" + s + " (added)\n"
+				continue
+			}
+
+			// 变化的字段都被手动调整的线程数或限速覆盖，update 不会改变运行中的配置
+			if len(diffs) == 0 {
+				str += "\t" + s + " (overridden by manual operations)\n"
+				continue
+			}
+
+			str += "\t" + s + "\n"
+			for _, d := range diffs {
+				str += "\t\t" + d.Field + ": " + d.Old + " -> " + d.New + "\n"
+			}
 		}
-		str = strings.TrimRight(str, ", ")
-		str += "\n"
 	}
 
 	if len(data.Removes) > 0 {
@@ -293,11 +401,259 @@ func (this *Interactive) reread() {
 			str = str + s + ", "
 		}
 		str = strings.TrimRight(str, ", ")
+		str += "\n"
+	}
+
+	if len(data.Invalids) > 0 {
+		str += "Invalids:"
+		for file, e := range data.Invalids {
+			str += "\n\t" + file + ": " + e
+		}
+	}
+	str = strings.TrimRight(str, "\n")
+
+	this.response(str)
+}
+
+// history 展示最近的配置版本，指定版本号时展示该版本的变化和配置文件
+func (this *Interactive) history(c cmd) {
+	if len(c.data) > 0 {
+		this.version(c.data[0])
+		return
+	}
+
+	res := Get("http://" + this.ServerUrl + "/config/history")
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	data := make([]responses.VersionResponse, 0)
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	if len(data) == 0 {
+		this.response("No config history.")
+		return
+	}
+
+	rows := make([][]string, 0, len(data))
+	for _, v := range data {
+		source := v.Source
+		if v.Rollback > 0 {
+			source += fmt.Sprintf(" (rollback to %d)", v.Rollback)
+		}
+
+		changes := make([]string, 0, len(v.Changes))
+		for _, change := range v.Changes {
+			changes = append(changes, change.Name+" "+change.Action)
+		}
+
+		rows = append(rows, []string{strconv.FormatInt(v.Id, 10), v.Time, source, strings.Join(changes, ", ")})
+	}
+	this.response(table(rows))
+}
+
+func (this *Interactive) version(id string) {
+	res := Get("http://" + this.ServerUrl + "/config/history?version=" + url.QueryEscape(id))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	var data responses.VersionResponse
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	str := fmt.Sprintf("Version %d, %s by %s", data.Id, data.Time, data.Source)
+	if data.Rollback > 0 {
+		str += fmt.Sprintf(", rollback to %d", data.Rollback)
+	}
+	str += "\n"
+
+	if len(data.Changes) > 0 {
+		str += "Changes:\n"
+		for _, change := range data.Changes {
+			str += "\t" + change.Name + " (" + change.Action + ")\n"
+			for _, d := range change.Diffs {
+				str += "\t\t" + d.Field + ": " + d.Old + " -> " + d.New + "\n"
+			}
+		}
+	}
+
+	if len(data.Files) > 0 {
+		files := make([]string, 0, len(data.Files))
+		for file := range data.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		str += "Files:\n\t" + strings.Join(files, "\n\t")
+	}
+	this.response(strings.TrimRight(str, "\n"))
+}
+
+// rollback 把配置文件恢复为指定版本的内容并应用
+func (this *Interactive) rollback(c cmd, scanner *bufio.Scanner) {
+	if len(c.data) == 0 {
+		this.response(`Error: rollback requires a version
+rollback <version>	Restore the jobber config files of a version and apply them`)
+		return
+	}
+
+	fmt.Printf("Really rollback the jobber config files to version %s y/N? ", c.data[0])
+	if !scanner.Scan() {
+		return
 	}
 
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if answer != "y" && answer != "yes" {
+		this.response()
+		return
+	}
+
+	res := Post("http://"+this.ServerUrl+"/config/rollback?version="+url.QueryEscape(c.data[0]), "", nil)
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	this.updateResults(res)
+}
+
+// check 让服务端校验所有配置文件，不会应用
+func (this *Interactive) check() {
+	data, err := validate(this.ServerUrl)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	str, _ := validateReport(data)
 	this.response(str)
 }
 
+// add 读取本地的配置文件，由服务端校验后写入 include 目录并应用
+func (this *Interactive) add(c cmd) {
+	if len(c.data) < 2 {
+		this.response(`Error: add requires a jobber name and a config file
+add <name> <file>	Add a jobber with a local yaml config file`)
+		return
+	}
+
+	content, err := ioutil.ReadFile(c.data[1])
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	res := Post("http://"+this.ServerUrl+"/jobbers/"+url.PathEscape(c.data[0]), "application/x-yaml", bytes.NewReader(content))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	this.updateResults(res)
+}
+
+// edit 用 $EDITOR 编辑 jobber 的配置文件，保存后由服务端校验并应用
+func (this *Interactive) edit(c cmd) {
+	if len(c.data) == 0 {
+		this.response(`Error: edit requires a jobber name
+edit <name>		Edit the config of a jobber with $EDITOR`)
+		return
+	}
+
+	uri := "http://" + this.ServerUrl + "/jobbers/" + url.PathEscape(c.data[0])
+	res := Get(uri)
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	var data responses.JobberFileResponse
+	if err := json.Unmarshal(res.Attachment, &data); err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	tmp, err := ioutil.TempFile("", c.data[0]+".yaml.")
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(data.Content)
+	tmp.Close()
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	e := exec.Command(editor, tmp.Name())
+	e.Stdin, e.Stdout, e.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := e.Run(); err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	content, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+	if string(content) == data.Content {
+		this.response("No changes.")
+		return
+	}
+
+	res = Put(uri, "application/x-yaml", bytes.NewReader(content))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	this.updateResults(res)
+}
+
+// delete 删除 jobber 的配置文件，jobber 停止后被移除
+func (this *Interactive) delete(c cmd, scanner *bufio.Scanner) {
+	if len(c.data) == 0 {
+		this.response(`Error: delete requires a jobber name
+delete <name>		Stop a jobber and delete its config file`)
+		return
+	}
+
+	fmt.Printf("Really delete the config file of %s y/N? ", c.data[0])
+	if !scanner.Scan() {
+		return
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if answer != "y" && answer != "yes" {
+		this.response()
+		return
+	}
+
+	res := Delete("http://" + this.ServerUrl + "/jobbers/" + url.PathEscape(c.data[0]))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	this.updateResults(res)
+}
+
 func (this *Interactive) update() {
 	res := Get("http://" + this.ServerUrl + "/mq/update")
 	if res.Success() == false {
@@ -305,21 +661,313 @@ func (this *Interactive) update() {
 		return
 	}
 
-	this.response("Updated all success.")
+	this.updateResults(res)
+}
+
+func (this *Interactive) reload(c cmd) {
+	if len(c.data) == 0 {
+		this.response(`Error: reload requires a jobber name
+reload <name>		Reload the config of a jobber
+reload <gname>:*	Reload all jobbers in a group
+reload <name> <name>	Reload multiple jobbers or groups`)
+		return
+	}
+
+	res := Get("http://" + this.ServerUrl + "/mq/reload?" + nameQuery(c.data))
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	this.updateResults(res)
+}
+
+func (this *Interactive) updateResults(res *Response) {
+	data := make([]responses.UpdateResponse, 0)
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	if len(data) == 0 {
+		this.response("No changes.")
+		return
+	}
+
+	rows := make([][]string, 0, len(data))
+	for _, r := range data {
+		detail := strings.Join(r.Fields, ", ")
+		if r.Error != "" {
+			detail = r.Error
+		}
+		rows = append(rows, []string{r.Name, r.Action, detail})
+	}
+	this.response(table(rows))
 }
 
 func (this *Interactive) restart(c cmd) {
 	if len(c.data) == 0 {
 		this.response(`Error: restart requires a jobber name
 restart <name>		restart a process
+restart <gname>:*	Restart all jobbers in a group
+restart <name> <name>	Restart multiple jobbers or groups
 restart all		Restart all jobbers`)
 		return
 	}
-	name := c.data[0]
-	res := Get("http://" + this.ServerUrl + "/mq/restart?name=" + name)
+
+	this.control("restart", c.data)
+}
+
+func (this *Interactive) pause(c cmd) {
+	names := make([]string, 0, len(c.data))
+	var until string
+	for _, v := range c.data {
+		if strings.HasPrefix(v, "until=") {
+			until = strings.TrimPrefix(v, "until=")
+			continue
+		}
+		names = append(names, v)
+	}
+
+	if len(names) == 0 {
+		this.response(`Error: pause requires a jobber name
+pause <name>			Pause a jobber
+pause <gname>:*			Pause all jobbers in a group
+pause <name> <name>		Pause multiple jobbers or groups
+pause <name> until=<time>	Pause and resume automatically, time is a unix timestamp, RFC3339 or duration like 30m`)
+		return
+	}
+
+	query := nameQuery(names)
+	if until != "" {
+		query += "&until=" + url.QueryEscape(until)
+	}
+	this.controlQuery("pause", query)
+}
+
+func (this *Interactive) resume(c cmd) {
+	if len(c.data) == 0 {
+		this.response(`Error: resume requires a jobber name
+resume <name>		Resume a paused jobber
+resume <gname>:*	Resume all jobbers in a group
+resume <name> <name>	Resume multiple jobbers or groups`)
+		return
+	}
+
+	this.control("resume", c.data)
+}
+
+func (this *Interactive) scale(c cmd) {
+	usage := `Error: scale requires a jobber name and worker number
+scale <name> <n>		Set the worker number of a jobber
+scale <gname>:* <n>		Set the worker number of all jobbers in a group
+scale <name> <name> <n>		Set the worker number of multiple jobbers or groups`
+
+	if len(c.data) < 2 {
+		this.response(usage)
+		return
+	}
+
+	num := c.data[len(c.data)-1]
+	if n, err := strconv.Atoi(num); err != nil || n <= 0 {
+		this.response(usage)
+		return
+	}
+
+	this.controlQuery("scale", nameQuery(c.data[:len(c.data)-1])+"&num="+num)
+}
+
+func (this *Interactive) autoscale(c cmd) {
+	usage := `Error: autoscale requires a jobber name and on/off
+autoscale <name> on		Resume autoscaling of a jobber
+autoscale <name> off		Stop autoscaling and keep the current worker number
+autoscale <gname>:* on|off	Switch autoscaling of all jobbers in a group`
+
+	if len(c.data) < 2 {
+		this.response(usage)
+		return
+	}
+
+	var enable string
+	switch c.data[len(c.data)-1] {
+	case "on":
+		enable = "true"
+	case "off":
+		enable = "false"
+	default:
+		this.response(usage)
+		return
+	}
+
+	this.controlQuery("autoscale", nameQuery(c.data[:len(c.data)-1])+"&enable="+enable)
+}
+
+func (this *Interactive) ratelimit(c cmd) {
+	usage := `Error: ratelimit requires a jobber name and rate
+ratelimit <name> <rate>		Set the requests per second of a jobber, 0 for no limit
+ratelimit <gname>:* <rate>	Set the rate limit of all jobbers in a group`
+
+	if len(c.data) < 2 {
+		this.response(usage)
+		return
+	}
+
+	rate := c.data[len(c.data)-1]
+	if r, err := strconv.ParseFloat(rate, 64); err != nil || r < 0 {
+		this.response(usage)
+		return
+	}
+
+	this.controlQuery("ratelimit", nameQuery(c.data[:len(c.data)-1])+"&rate="+rate)
+}
+
+// clear 清除重启后仍然保持的手动操作
+func (this *Interactive) clear(c cmd) {
+	if len(c.data) == 0 {
+		this.response(`Error: clear requires a jobber name
+clear <name>		Forget the manual stop, pause, scale and rate limit of a jobber
+clear <gname>:*		Forget the manual operations of all jobbers in a group
+clear all		Forget the manual operations of all jobbers`)
+		return
+	}
+
+	this.control("clear", c.data)
+}
+
+// workers 展示 jobber 正在处理的请求，超过慢请求阈值的标记为 SLOW，也可以取消一个请求
+func (this *Interactive) workers(c cmd, scanner *bufio.Scanner) {
+	if len(c.data) == 0 || (len(c.data) > 1 && (len(c.data) != 3 || c.data[1] != "cancel")) {
+		this.response(`Error: workers requires a jobber name
+workers <name>			List the in-flight requests of a jobber
+workers <name> cancel <id>	Cancel the in-flight request of a worker`)
+		return
+	}
+
+	uri := "http://" + this.ServerUrl + "/jobbers/" + url.PathEscape(c.data[0]) + "/workers"
+	if len(c.data) == 3 {
+		fmt.Printf("Really cancel the request of worker %s of %s y/N? ", c.data[2], c.data[0])
+		if !scanner.Scan() {
+			return
+		}
+
+		answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if answer != "y" && answer != "yes" {
+			this.response()
+			return
+		}
+
+		res := Delete(uri + "/" + url.PathEscape(c.data[2]))
+		if res.Success() == false {
+			this.response(res.Message)
+			return
+		}
+		this.response(fmt.Sprintf("%s: worker %s canceled", c.data[0], c.data[2]))
+		return
+	}
+
+	res := Get(uri)
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	data := make([]responses.WorkerResponse, 0)
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	if len(data) == 0 {
+		this.response("No in-flight requests.")
+		return
+	}
+
+	rows := [][]string{{"id", "tag", "message id", "start", "elapsed", "flag", "preview"}}
+	for _, w := range data {
+		flags := make([]string, 0)
+		if w.Slow {
+			flags = append(flags, "SLOW")
+		}
+		if w.Canceled {
+			flags = append(flags, "CANCELED")
+		}
+
+		messageId := w.MessageId
+		if messageId == "" {
+			messageId = "-"
+		}
+
+		rows = append(rows, []string{
+			strconv.Itoa(w.Id),
+			strconv.FormatUint(w.DeliveryTag, 10),
+			messageId,
+			w.StartTime,
+			(time.Duration(w.Elapsed) * time.Millisecond).String(),
+			strings.Join(flags, ","),
+			strings.Replace(w.Preview, "\n", " ", -1),
+		})
+	}
+	this.response(table(rows))
+}
+
+// nameQuery 把多个名称拼接为 name 参数
+func nameQuery(names []string) string {
+	query := url.Values{}
+	for _, name := range names {
+		query.Add("name", name)
+	}
+	return query.Encode()
+}
+
+// control 对多个 jobber 执行操作，逐个展示结果
+func (this *Interactive) control(action string, names []string) {
+	this.controlQuery(action, nameQuery(names))
+}
+
+func (this *Interactive) controlQuery(action string, query string) {
+	res := Get("http://" + this.ServerUrl + "/mq/" + action + "?" + query)
+	if res.Success() == false {
+		this.response(res.Message)
+		return
+	}
+
+	data := make([]responses.ControlResponse, 0)
+	err := json.Unmarshal(res.Attachment, &data)
+	if err != nil {
+		this.response(err.Error())
+		return
+	}
+
+	rows := make([][]string, 0, len(data))
+	for _, r := range data {
+		result := action + " ok"
+		if !r.Success {
+			result = "ERROR (" + r.Error + ")"
+		}
+		rows = append(rows, []string{r.Name, result})
+	}
+	this.response(table(rows))
+}
+
+func (this *Interactive) shutdown(scanner *bufio.Scanner) {
+	fmt.Print("Really shut the remote jobber server down y/N? ")
+	if !scanner.Scan() {
+		return
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	if answer != "y" && answer != "yes" {
+		this.response()
+		return
+	}
+
+	res := Post("http://"+this.ServerUrl+"/mq/shutdown", "", nil)
 	if res.Success() == false {
 		this.response(res.Message)
-	} else {
-		this.response(res.String())
+		return
 	}
+
+	this.response("Shut down")
 }
@@ -0,0 +1,35 @@
+package console
+
+import "strings"
+
+const spaceNum = 4
+
+// table 按列对齐输出多行数据
+func table(rows [][]string) string {
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, col := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+
+			if len(col) > widths[i] {
+				widths[i] = len(col)
+			}
+		}
+	}
+
+	var str string
+	for _, row := range rows {
+		var line string
+		for i, col := range row {
+			line += col
+			if i < len(row)-1 {
+				line += strings.Repeat(" ", spaceNum+widths[i]-len(col))
+			}
+		}
+		str = str + line + "\n"
+	}
+
+	return strings.TrimRight(str, "\n")
+}
@@ -2,12 +2,152 @@ package responses
 
 type StatusResponse struct {
 	Name       string `json:"name"`
+	Group      string `json:"group"`
 	QueueName  string `json:"queue_name"`
 	Status     string `json:"status"`
 	StatusTime string `json:"status_time"`
+	PauseUntil string `json:"pause_until"`
+
+	Workers     int                `json:"workers"`
+	BusyWorkers int                `json:"busy_workers"`
+	Autoscale   *AutoscaleResponse `json:"autoscale"`
+	Intents     []string           `json:"intents"`
+	Uptime      int64              `json:"uptime"` // 秒
+	Stats       StatsResponse      `json:"stats"`
+
+	Messages     int    `json:"messages"`
+	Unacked      int64  `json:"unacked"`
+	Consumers    int    `json:"consumers"`
+	InspectError string `json:"inspect_error"`
+	InspectTime  string `json:"inspect_time"`
+}
+
+type StatsResponse struct {
+	Processed       int64   `json:"processed"`
+	Failed          int64   `json:"failed"`
+	SuccessRate     float64 `json:"success_rate"`
+	Rate1m          float64 `json:"rate_1m"`
+	Rate5m          float64 `json:"rate_5m"`
+	Rate15m         float64 `json:"rate_15m"`
+	LatencyP50      int64   `json:"latency_p50"` // 毫秒
+	LatencyP95      int64   `json:"latency_p95"`
+	LatencyP99      int64   `json:"latency_p99"`
+	LastError       string  `json:"last_error"`
+	LastErrorTime   string  `json:"last_error_time"`
+	LastSuccessTime string  `json:"last_success_time"`
+}
+
+type AutoscaleResponse struct {
+	Active        bool   `json:"active"`
+	Min           int    `json:"min"`
+	Max           int    `json:"max"`
+	Limit         int    `json:"limit"`
+	TargetLatency int64  `json:"target_latency"`
+	Latency       int64  `json:"latency"`
+	Backlog       int    `json:"backlog"`
+	Decision      string `json:"decision"`
+	DecisionTime  string `json:"decision_time"`
+}
+
+type ControlResponse struct {
+	Name    string `json:"name"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
 }
 
 type RereadResponse struct {
-	Changes []string `json:"changes"`
-	Removes []string `json:"removes"`
+	Changes  []string                       `json:"changes"`
+	Diffs    map[string][]FieldDiffResponse `json:"diffs"`
+	Removes  []string                       `json:"removes"`
+	Invalids map[string]string              `json:"invalids"`
+}
+
+type FieldDiffResponse struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type VersionResponse struct {
+	Id       int64                   `json:"id"`
+	Time     string                  `json:"time"`
+	Source   string                  `json:"source"`
+	Rollback int64                   `json:"rollback"`
+	Changes  []VersionChangeResponse `json:"changes"`
+	Jobbers  []string                `json:"jobbers"`
+	Configs  map[string]string       `json:"configs,omitempty"`
+	Files    map[string]string       `json:"files,omitempty"`
+}
+
+type VersionChangeResponse struct {
+	Name   string              `json:"name"`
+	Action string              `json:"action"`
+	Diffs  []FieldDiffResponse `json:"diffs"`
+	Error  string              `json:"error"`
+}
+
+type UpdateResponse struct {
+	Name   string   `json:"name"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields"`
+	Error  string   `json:"error"`
+}
+
+type BrokerResponse struct {
+	Addr                string `json:"addr"`
+	Connected           bool   `json:"connected"`
+	Blocked             bool   `json:"blocked"`
+	BlockedReason       string `json:"blocked_reason"`
+	LastError           string `json:"last_error"`
+	LastErrorTime       string `json:"last_error_time"`
+	LastConnected       string `json:"last_connected"`
+	LastDisconnected    string `json:"last_disconnected"`
+	Failures            int64  `json:"failures"`
+	ConsecutiveFailures int64  `json:"consecutive_failures"`
+}
+
+type EventResponse struct {
+	Id      int64  `json:"id"`
+	Time    string `json:"time"`
+	Type    string `json:"type"`
+	Source  string `json:"source"`
+	Jobber  string `json:"jobber"`
+	Message string `json:"message"`
+}
+
+type TransitionResponse struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Time   string `json:"time"`
+	Reason string `json:"reason"`
+}
+
+type JobberFileResponse struct {
+	File    string `json:"file"`
+	Content string `json:"content"`
+}
+
+type WorkerResponse struct {
+	Id          int    `json:"id"`
+	DeliveryTag uint64 `json:"delivery_tag"`
+	MessageId   string `json:"message_id"`
+	Preview     string `json:"preview"`
+	Target      string `json:"target"`
+	StartTime   string `json:"start_time"`
+	Elapsed     int64  `json:"elapsed"` // 毫秒
+	Slow        bool   `json:"slow"`
+	Canceled    bool   `json:"canceled"`
+}
+
+type IssueResponse struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type ValidateResponse struct {
+	File   string          `json:"file"`
+	Name   string          `json:"name"`
+	Valid  bool            `json:"valid"`
+	Issues []IssueResponse `json:"issues"`
 }
@@ -11,7 +11,11 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -26,7 +30,9 @@ func main() {
 		panic(err)
 	}
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancle := context.WithCancel(context.Background())
+	defer cancle()
+
 	err := mq.Init(ctx)
 	if err != nil {
 		panic(err)
@@ -42,9 +48,38 @@ func main() {
 }
 
 func serve(g *gin.Engine) {
-	log.Infof("http server listen on %s", viper.GetString("server.addr"))
-	err := http.ListenAndServe(viper.GetString("server.addr"), g).Error()
-	if err != "" {
-		log.Panic(err)
+	srv := &http.Server{
+		Addr:    viper.GetString("server.addr"),
+		Handler: g,
+	}
+
+	go func() {
+		log.Infof("http server listen on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Panic(err)
+		}
+	}()
+
+	// 等待退出信号或者 shutdown 请求
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case s := <-quit:
+		log.Infof("Received signal %s", s.String())
+	case <-mq.ShutdownNotify():
+		log.Info("Received shutdown request")
+	}
+
+	viper.SetDefault("server.shutdown_timeout", 30)
+	timeout := time.Duration(viper.GetInt("server.shutdown_timeout")) * time.Second
+
+	// 先停止所有 jobber 并等待正在处理的请求完成，再关闭 http 服务
+	mq.Shutdown(timeout)
+
+	ctx, cancle := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancle()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Errorf("http server shutdown failed with error: %s", err.Error())
 	}
+	log.Info("http server exits")
 }
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gitlab.mydadao.com/marketing/message_jobber/responses"
+	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
+	"gitlab.mydadao.com/marketing/message_jobber/server/pkg/errno"
+	"gitlab.mydadao.com/marketing/wechat/src/utils"
+	"sort"
+	"strconv"
+)
+
+// Config 查询配置的历史版本以及回滚
+type Config struct {
+	Base
+}
+
+// History 获取最近的配置版本，指定 version 时返回该版本生效的配置和配置文件的内容
+func (this *Config) History(c *gin.Context) {
+	if v := c.Query("version"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			this.Failed(c, errno.ParamsErr.Add("version"))
+			return
+		}
+
+		version, err := mq.History.Get(id)
+		if err != nil {
+			this.Failed(c, errno.InternalServerError.Add(err.Error()))
+			return
+		}
+
+		r := versionResponse(version)
+		r.Configs = version.Configs()
+		r.Files = version.Files
+		this.Success(c, r)
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	versions := mq.History.List(limit)
+	list := make([]responses.VersionResponse, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, versionResponse(v))
+	}
+
+	this.Success(c, list)
+}
+
+// Rollback 把配置文件恢复为指定版本的内容并应用
+func (this *Config) Rollback(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Query("version"), 10, 64)
+	if err != nil || id <= 0 {
+		this.Failed(c, errno.ParamsErr.Add("version"))
+		return
+	}
+
+	results, err := mq.Jobbers.Rollback(id, source(c))
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	list := make([]responses.UpdateResponse, 0, len(results))
+	for _, r := range results {
+		list = append(list, updateResponse(r))
+	}
+
+	this.Success(c, list)
+}
+
+func versionResponse(v mq.Version) responses.VersionResponse {
+	changes := make([]responses.VersionChangeResponse, 0, len(v.Changes))
+	for _, change := range v.Changes {
+		changes = append(changes, responses.VersionChangeResponse{
+			Name:   change.Name,
+			Action: change.Action,
+			Diffs:  fieldDiffResponses(change.Diffs),
+			Error:  change.Error,
+		})
+	}
+
+	jobbers := make([]string, 0, len(v.Options))
+	for name := range v.Options {
+		jobbers = append(jobbers, name)
+	}
+	sort.Strings(jobbers)
+
+	return responses.VersionResponse{
+		Id:       v.Id,
+		Time:     utils.TimeFormat(v.Time),
+		Source:   v.Source,
+		Rollback: v.Rollback,
+		Changes:  changes,
+		Jobbers:  jobbers,
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gitlab.mydadao.com/marketing/message_jobber/responses"
+	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
+	"gitlab.mydadao.com/marketing/message_jobber/server/pkg/errno"
+	"gitlab.mydadao.com/marketing/wechat/src/utils"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// Jobbers 通过 api 管理 jobber 的配置文件，请求体为 yaml(或 json)格式的 jobber 配置
+type Jobbers struct {
+	Base
+}
+
+func (this *Jobbers) Get(c *gin.Context) {
+	file, content, err := mq.Jobbers.ReadFile(c.Param("name"))
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	this.Success(c, responses.JobberFileResponse{
+		File:    file,
+		Content: string(content),
+	})
+}
+
+func (this *Jobbers) Create(c *gin.Context) {
+	this.write(c, mq.Jobbers.Create)
+}
+
+func (this *Jobbers) Replace(c *gin.Context) {
+	this.write(c, mq.Jobbers.Replace)
+}
+
+func (this *Jobbers) Delete(c *gin.Context) {
+	results, err := mq.Jobbers.Delete(c.Param("name"), source(c))
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	this.updated(c, results)
+}
+
+// Workers 获取 jobber 正在处理请求的工作线程
+func (this *Jobbers) Workers(c *gin.Context) {
+	infos, err := mq.Jobbers.Workers(c.Param("name"))
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	list := make([]responses.WorkerResponse, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, responses.WorkerResponse{
+			Id:          info.Id,
+			DeliveryTag: info.DeliveryTag,
+			MessageId:   info.MessageId,
+			Preview:     info.Preview,
+			Target:      info.Target,
+			StartTime:   utils.TimeFormat(info.Start),
+			Elapsed:     info.Elapsed.Nanoseconds() / int64(time.Millisecond),
+			Slow:        info.Slow,
+			Canceled:    info.Canceled,
+		})
+	}
+
+	this.Success(c, list)
+}
+
+// CancelWorker 取消工作线程正在处理的请求
+func (this *Jobbers) CancelWorker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 0 {
+		this.Failed(c, errno.ParamsErr.Add("id"))
+		return
+	}
+
+	if err := mq.Jobbers.CancelWorker(c.Param("name"), id); err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	this.Success(c, gin.H{})
+}
+
+func (this *Jobbers) write(c *gin.Context, fn func(name string, content []byte, source string) ([]mq.UpdateResult, error)) {
+	content, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+	if len(content) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("body"))
+		return
+	}
+
+	results, err := fn(c.Param("name"), content, source(c))
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		return
+	}
+
+	this.updated(c, results)
+}
+
+func (this *Jobbers) updated(c *gin.Context, results []mq.UpdateResult) {
+	list := make([]responses.UpdateResponse, 0, len(results))
+	for _, r := range results {
+		list = append(list, updateResponse(r))
+	}
+
+	this.Success(c, list)
+}
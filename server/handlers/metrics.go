@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
+	"net/http"
+)
+
+// Metrics 以 Prometheus 文本格式输出指标，不使用统一的 json 响应
+type Metrics struct {
+	Base
+}
+
+func (this *Metrics) Index(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", mq.Metrics())
+}
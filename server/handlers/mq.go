@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -8,67 +9,262 @@ import (
 	"gitlab.mydadao.com/marketing/message_jobber/server/mq"
 	"gitlab.mydadao.com/marketing/message_jobber/server/pkg/errno"
 	"gitlab.mydadao.com/marketing/wechat/src/utils"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Mq struct {
 	Base
 }
 
+// names 获取请求中的 jobber 名称，可以重复传入 name 参数或者用逗号分隔，支持 all、<group>:* 和通配符
+func names(c *gin.Context) []string {
+	list := make([]string, 0)
+	for _, v := range c.QueryArray("name") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				list = append(list, name)
+			}
+		}
+	}
+	return list
+}
+
+// source 获取请求的来源，console 发出的请求带有 X-Jobber-Source 头
+func source(c *gin.Context) string {
+	if c.GetHeader("X-Jobber-Source") == mq.SOURCE_CONSOLE {
+		return mq.SOURCE_CONSOLE
+	}
+	return mq.SOURCE_API
+}
+
+func controlResponses(results []mq.ControlResult) []responses.ControlResponse {
+	list := make([]responses.ControlResponse, 0, len(results))
+	for _, r := range results {
+		list = append(list, responses.ControlResponse{
+			Name:    r.Name,
+			Success: r.Error == "",
+			Error:   r.Error,
+		})
+	}
+	return list
+}
+
 func (this *Mq) Start(c *gin.Context) {
-	name := c.DefaultQuery("name", "")
-	if name == "" {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Start)))
+}
+
+func (this *Mq) Stop(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
 		this.Failed(c, errno.ParamsErr.Add("name"))
 		return
 	}
 
-	var err error
-	if name == "all" {
-		err = mq.Jobbers.StartAll()
-	} else {
-		err = mq.Jobbers.Start(name)
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Stop)))
+}
+
+// pauseUntil 解析暂停的到期时间，支持 unix 时间戳、2006-01-02 15:04:05、RFC3339 以及相对时长如 30m
+func pauseUntil(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
 	}
 
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, errors.New(fmt.Sprintf("Invalid pause until time %s", s))
+	}
+	return time.Now().Add(d), nil
+}
+
+func (this *Mq) Pause(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	until, err := pauseUntil(c.DefaultQuery("until", ""))
 	if err != nil {
 		this.Failed(c, errno.InternalServerError.Add(err.Error()))
 		return
 	}
 
-	if name == "all" {
-		this.Success(c, "All started.")
-	} else {
-		this.Success(c, fmt.Sprintf("%s started.", name))
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, func(name string) error {
+		return mq.Jobbers.Pause(name, until)
+	})))
+}
+
+func (this *Mq) Resume(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
 	}
 
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Resume)))
 }
 
-func (this *Mq) Stop(c *gin.Context) {
-	name := c.DefaultQuery("name", "")
-	if name == "" {
+func (this *Mq) Scale(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
 		this.Failed(c, errno.ParamsErr.Add("name"))
 		return
 	}
 
-	var err error
-	if name == "all" {
-		err = mq.Jobbers.StopAll()
-	} else {
-		err = mq.Jobbers.Stop(name)
+	num, err := strconv.Atoi(c.DefaultQuery("num", ""))
+	if err != nil || num <= 0 {
+		this.Failed(c, errno.ParamsErr.Add("num"))
+		return
 	}
 
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, func(name string) error {
+		return mq.Jobbers.Scale(name, num)
+	})))
+}
+
+func (this *Mq) Autoscale(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	enable, err := strconv.ParseBool(c.DefaultQuery("enable", ""))
 	if err != nil {
-		this.Failed(c, errno.InternalServerError.Add(err.Error()))
+		this.Failed(c, errno.ParamsErr.Add("enable"))
 		return
 	}
 
-	if name == "all" {
-		this.Success(c, "All stoped.")
-	} else {
-		this.Success(c, fmt.Sprintf("%s stopped", name))
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, func(name string) error {
+		return mq.Jobbers.SetAutoscale(name, enable)
+	})))
+}
+
+// RateLimit 手动修改限速，rate 为每秒请求数，为 0 时不限速
+func (this *Mq) RateLimit(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	rate, err := strconv.ParseFloat(c.DefaultQuery("rate", ""), 64)
+	if err != nil || rate < 0 {
+		this.Failed(c, errno.ParamsErr.Add("rate"))
+		return
 	}
+
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, func(name string) error {
+		return mq.Jobbers.SetRateLimit(name, rate)
+	})))
 }
 
+// Clear 清除 jobber 在重启后仍然保持的停止、暂停、线程数和限速
+func (this *Mq) Clear(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Clear)))
+}
+
+func autoscaleResponse(info mq.AutoscaleInfo) *responses.AutoscaleResponse {
+	if !info.Enable {
+		return nil
+	}
+
+	var decisionTime string
+	if !info.DecisionTime.IsZero() {
+		decisionTime = utils.TimeFormat(info.DecisionTime)
+	}
+
+	return &responses.AutoscaleResponse{
+		Active:        info.Active,
+		Min:           info.Min,
+		Max:           info.Max,
+		Limit:         info.Limit,
+		TargetLatency: info.TargetLatency.Nanoseconds() / int64(time.Millisecond),
+		Latency:       info.Latency.Nanoseconds() / int64(time.Millisecond),
+		Backlog:       info.Backlog,
+		Decision:      info.Decision,
+		DecisionTime:  decisionTime,
+	}
+}
+
+func statsResponse(stats mq.Stats) responses.StatsResponse {
+	var lastErrorTime, lastSuccessTime string
+	if !stats.LastErrorTime.IsZero() {
+		lastErrorTime = utils.TimeFormat(stats.LastErrorTime)
+	}
+	if !stats.LastSuccessTime.IsZero() {
+		lastSuccessTime = utils.TimeFormat(stats.LastSuccessTime)
+	}
+
+	return responses.StatsResponse{
+		Processed:       stats.Processed,
+		Failed:          stats.Failed,
+		SuccessRate:     stats.SuccessRate,
+		Rate1m:          stats.Rate1m,
+		Rate5m:          stats.Rate5m,
+		Rate15m:         stats.Rate15m,
+		LatencyP50:      stats.P50.Nanoseconds() / int64(time.Millisecond),
+		LatencyP95:      stats.P95.Nanoseconds() / int64(time.Millisecond),
+		LatencyP99:      stats.P99.Nanoseconds() / int64(time.Millisecond),
+		LastError:       stats.LastError,
+		LastErrorTime:   lastErrorTime,
+		LastSuccessTime: lastSuccessTime,
+	}
+}
+
+// Status 获取 jobber 的状态，可以用 name 参数筛选，不传时返回所有 jobber
 func (this *Mq) Status(c *gin.Context) {
 	jbs := mq.Jobbers.List()
+	refresh := c.DefaultQuery("refresh", "") != ""
+
+	if patterns := names(c); len(patterns) > 0 {
+		matched, unmatched := mq.Jobbers.Match(patterns...)
+		if len(unmatched) > 0 {
+			this.Failed(c, errno.InternalServerError.Add(fmt.Sprintf("Not found jobber %s", strings.Join(unmatched, ", "))))
+			return
+		}
+
+		selected := make(map[string]bool)
+		for _, name := range matched {
+			selected[name] = true
+		}
+
+		list := make([]*mq.Jobber, 0, len(matched))
+		for _, jb := range jbs {
+			if selected[jb.GetName()] {
+				list = append(list, jb)
+			}
+		}
+		jbs = list
+	}
 
 	logrus.Infoln(len(jbs))
 	list := make([]responses.StatusResponse, 0, len(jbs))
@@ -77,17 +273,42 @@ func (this *Mq) Status(c *gin.Context) {
 		status, statusStr := jb.GetStatus()
 
 		var t string
-		if status == 1 {
+		if status == mq.RUNNING || status == mq.PAUSED {
 			t = utils.TimeFormat(jb.GetStartTime())
 		} else {
 			t = utils.TimeFormat(jb.GetStopTime())
 		}
 
+		var pauseUntil string
+		if until := jb.GetPauseUntil(); !until.IsZero() {
+			pauseUntil = utils.TimeFormat(until)
+		}
+
+		workers, busy := jb.GetWorkerNum()
+		info := jb.GetQueueInfo(refresh)
+		var inspectTime string
+		if !info.InspectTime.IsZero() {
+			inspectTime = utils.TimeFormat(info.InspectTime)
+		}
+
 		list = append(list, responses.StatusResponse{
-			Name:       jb.GetName(),
-			QueueName:  jb.GetQueueName(),
-			Status:     statusStr,
-			StatusTime: t,
+			Name:         jb.GetName(),
+			Group:        jb.GetGroup(),
+			QueueName:    jb.GetQueueName(),
+			Status:       statusStr,
+			StatusTime:   t,
+			PauseUntil:   pauseUntil,
+			Workers:      workers,
+			BusyWorkers:  busy,
+			Autoscale:    autoscaleResponse(jb.GetAutoscale()),
+			Intents:      jb.GetIntent().Items(),
+			Uptime:       int64(jb.GetUptime().Seconds()),
+			Stats:        statsResponse(jb.GetStats()),
+			Messages:     info.Messages,
+			Unacked:      info.Unacked,
+			Consumers:    info.Consumers,
+			InspectError: info.Error,
+			InspectTime:  inspectTime,
 		})
 	}
 
@@ -95,61 +316,240 @@ func (this *Mq) Status(c *gin.Context) {
 }
 
 func (this *Mq) Reread(c *gin.Context) {
-	changes, removes, err := mq.Jobbers.Reread()
+	changes, removes, invalids, err := mq.Jobbers.Reread()
 	if err != nil {
 		this.Failed(c, errno.InternalServerError.Add(err.Error()))
 		return
 	}
 
-	this.Success(c, gin.H{
-		"changes": changes,
-		"removes": removes,
+	diffs := make(map[string][]responses.FieldDiffResponse)
+	for name, fields := range mq.Jobbers.Diffs() {
+		diffs[name] = fieldDiffResponses(fields)
+	}
+
+	this.Success(c, responses.RereadResponse{
+		Changes:  changes,
+		Diffs:    diffs,
+		Removes:  removes,
+		Invalids: invalids,
 	})
 }
 
 func (this *Mq) Update(c *gin.Context) {
-	mq.Jobbers.Update()
-	this.Success(c, "")
+	results := mq.Jobbers.Update(source(c))
+
+	list := make([]responses.UpdateResponse, 0, len(results))
+	for _, r := range results {
+		list = append(list, updateResponse(r))
+	}
+
+	this.Success(c, list)
+}
+
+func (this *Mq) Reload(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	matched, unmatched := mq.Jobbers.Match(patterns...)
+
+	list := make([]responses.UpdateResponse, 0, len(matched)+len(unmatched))
+	for _, name := range matched {
+		result, err := mq.Jobbers.Reload(name, source(c))
+		if err != nil {
+			result = mq.UpdateResult{
+				Name:   name,
+				Action: mq.UPDATE_FAILED,
+				Error:  err.Error(),
+			}
+		}
+		list = append(list, updateResponse(result))
+	}
+
+	for _, pattern := range unmatched {
+		list = append(list, updateResponse(mq.UpdateResult{
+			Name:   pattern,
+			Action: mq.UPDATE_FAILED,
+			Error:  fmt.Sprintf("Not found jobber %s", pattern),
+		}))
+	}
+
+	this.Success(c, list)
+}
+
+func fieldDiffResponses(diffs []mq.FieldDiff) []responses.FieldDiffResponse {
+	list := make([]responses.FieldDiffResponse, 0, len(diffs))
+	for _, d := range diffs {
+		list = append(list, responses.FieldDiffResponse{
+			Field: d.Field,
+			Old:   d.Old,
+			New:   d.New,
+		})
+	}
+	return list
+}
+
+func updateResponse(r mq.UpdateResult) responses.UpdateResponse {
+	fields := r.Fields
+	if fields == nil {
+		fields = []string{}
+	}
+
+	return responses.UpdateResponse{
+		Name:   r.Name,
+		Action: r.Action,
+		Fields: fields,
+		Error:  r.Error,
+	}
 }
 
 func (this *Mq) Remove(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Remove)))
+}
+
+func (this *Mq) Restart(c *gin.Context) {
+	patterns := names(c)
+	if len(patterns) == 0 {
+		this.Failed(c, errno.ParamsErr.Add("name"))
+		return
+	}
+
+	this.Success(c, controlResponses(mq.Jobbers.Each(patterns, mq.Jobbers.Restart)))
+}
+
+func (this *Mq) History(c *gin.Context) {
 	name := c.DefaultQuery("name", "")
 	if name == "" {
 		this.Failed(c, errno.ParamsErr.Add("name"))
 		return
 	}
 
-	err := mq.Jobbers.Remove(name)
+	history, err := mq.Jobbers.History(name)
 	if err != nil {
 		this.Failed(c, errno.InternalServerError.Add(err.Error()))
 		return
 	}
 
-	this.Success(c, fmt.Sprintf("Jobber %s removed", name))
+	list := make([]responses.TransitionResponse, 0, len(history))
+	for _, t := range history {
+		list = append(list, responses.TransitionResponse{
+			From:   t.From.String(),
+			To:     t.To.String(),
+			Time:   utils.TimeFormat(t.Time),
+			Reason: t.Reason,
+		})
+	}
+
+	this.Success(c, list)
 }
 
-func (this *Mq) Restart(c *gin.Context) {
-	name := c.DefaultQuery("name", "")
-	if name == "" {
-		this.Failed(c, errno.ParamsErr.Add("name"))
+func (this *Mq) Brokers(c *gin.Context) {
+	brokers := mq.Brokers.List()
+
+	timeFormat := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return utils.TimeFormat(t)
+	}
+
+	list := make([]responses.BrokerResponse, 0, len(brokers))
+	for _, b := range brokers {
+		list = append(list, responses.BrokerResponse{
+			Addr:                b.Addr,
+			Connected:           b.Connected,
+			Blocked:             b.Blocked,
+			BlockedReason:       b.BlockedReason,
+			LastError:           b.LastError,
+			LastErrorTime:       timeFormat(b.LastErrorTime),
+			LastConnected:       timeFormat(b.LastConnected),
+			LastDisconnected:    timeFormat(b.LastDisconnected),
+			Failures:            b.Failures,
+			ConsecutiveFailures: b.ConsecutiveFailures,
+		})
+	}
+
+	this.Success(c, list)
+}
+
+func (this *Mq) Events(c *gin.Context) {
+	since, _ := strconv.ParseInt(c.DefaultQuery("since", "0"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	events := mq.Events.List(since, limit)
+	list := make([]responses.EventResponse, 0, len(events))
+	for _, e := range events {
+		list = append(list, responses.EventResponse{
+			Id:      e.Id,
+			Time:    utils.TimeFormat(e.Time),
+			Type:    e.Type,
+			Source:  e.Source,
+			Jobber:  e.Jobber,
+			Message: e.Message,
+		})
+	}
+
+	this.Success(c, list)
+}
+
+// Validate 校验所有 jobber 配置文件但不应用，请求体不为空时作为 file 参数指定的配置文件一起校验
+func (this *Mq) Validate(c *gin.Context) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		this.Failed(c, errno.InternalServerError.Add(err.Error()))
 		return
 	}
 
-	var err error
-	if name == "all" {
-		err = mq.Jobbers.RestartAll()
-	} else {
-		err = mq.Jobbers.Restart(name)
+	var contents map[string][]byte
+	if len(body) > 0 {
+		file := c.DefaultQuery("file", "")
+		if file == "" {
+			this.Failed(c, errno.ParamsErr.Add("file"))
+			return
+		}
+		contents = map[string][]byte{file: body}
 	}
 
+	reports, err := mq.Validate(contents)
 	if err != nil {
 		this.Failed(c, errno.InternalServerError.Add(err.Error()))
 		return
 	}
 
-	if name == "all" {
-		this.Success(c, "All restarted.")
-	} else {
-		this.Success(c, fmt.Sprintf("%s restarted", name))
+	this.Success(c, validateResponses(reports))
+}
+
+func validateResponses(reports []mq.FileReport) []responses.ValidateResponse {
+	list := make([]responses.ValidateResponse, 0, len(reports))
+	for _, r := range reports {
+		issues := make([]responses.IssueResponse, 0, len(r.Issues))
+		for _, issue := range r.Issues {
+			issues = append(issues, responses.IssueResponse{
+				Line:    issue.Line,
+				Field:   issue.Field,
+				Message: issue.Message,
+			})
+		}
+
+		list = append(list, responses.ValidateResponse{
+			File:   r.File,
+			Name:   r.Name,
+			Valid:  r.Valid(),
+			Issues: issues,
+		})
 	}
+	return list
+}
+
+func (this *Mq) Shutdown(c *gin.Context) {
+	mq.RequestShutdown()
+	this.Success(c, "Shut down")
 }
@@ -0,0 +1,281 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	EVENT_AUTOSCALE  = "autoscale"
+	SOURCE_AUTOSCALE = "autoscaler"
+
+	// 延迟超过目标或者后端返回错误时线程数减少的比例
+	autoscaleDecrease = 0.75
+)
+
+// autoscaler 按照 AIMD 自动调整工作线程数：请求延迟超过目标或者后端出错时按比例减少，
+// 线程全部忙碌且队列有积压时逐个增加，空闲时逐个减少
+type autoscaler struct {
+	lock         sync.Mutex
+	disabled     bool // 手动关闭或者手动调整线程数后不再自动调整
+	limit        int
+	samples      int64
+	total        time.Duration
+	failures     int64
+	latency      time.Duration
+	backlog      int
+	decision     string
+	decisionTime time.Time
+}
+
+// AutoscaleInfo 自动调整的状态
+type AutoscaleInfo struct {
+	Enable        bool // 配置中是否开启
+	Active        bool // 是否正在自动调整，手动关闭后为 false
+	Min           int
+	Max           int
+	Limit         int
+	TargetLatency time.Duration
+	Latency       time.Duration // 最近一个调整周期的平均延迟
+	Backlog       int           // 最近一个调整周期队列中待消费的消息数
+	Decision      string
+	DecisionTime  time.Time
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// size 获取线程池应有的大小，lock 由调用方持有
+func (this *autoscaler) size(options jobberOptions) int {
+	if !options.Autoscale.Enable || this.disabled {
+		return options.WorkerNum
+	}
+
+	if this.limit <= 0 {
+		this.limit = options.WorkerNum
+	}
+	this.limit = clamp(this.limit, options.Autoscale.Min, options.Autoscale.Max)
+	return this.limit
+}
+
+// reset 启动时清空统计，返回线程池的初始大小
+func (this *autoscaler) reset(options jobberOptions) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.samples = 0
+	this.total = 0
+	this.failures = 0
+	this.limit = options.WorkerNum
+	return this.size(options)
+}
+
+// observe 记录一次请求的耗时，failed 表示请求出错或者后端返回 5xx
+func (this *autoscaler) observe(d time.Duration, failed bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.samples++
+	this.total += d
+	if failed {
+		this.failures++
+	}
+}
+
+// decide 根据一个周期内的延迟、错误、线程峰值和队列积压计算新的线程数
+func (this *autoscaler) decide(options jobberOptions, peak int, backlog int) (limit int, changed bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	samples, total, failures := this.samples, this.total, this.failures
+	this.samples, this.total, this.failures = 0, 0, 0
+
+	if !options.Autoscale.Enable || this.disabled {
+		return this.limit, false
+	}
+
+	this.latency = 0
+	if samples > 0 {
+		this.latency = total / time.Duration(samples)
+	}
+	this.backlog = backlog
+
+	old := this.size(options)
+	target := time.Duration(options.Autoscale.TargetLatency) * time.Millisecond
+
+	var reason string
+	limit = old
+	switch {
+	case failures > 0:
+		limit = int(float64(old) * autoscaleDecrease)
+		reason = fmt.Sprintf("%d failed requests", failures)
+	case samples > 0 && this.latency > target:
+		limit = int(float64(old) * autoscaleDecrease)
+		reason = fmt.Sprintf("latency %s over target %s", this.latency, target)
+	case backlog > 0 && peak >= old:
+		limit = old + 1
+		reason = fmt.Sprintf("backlog %d with all workers busy", backlog)
+	case backlog == 0 && peak < old/2:
+		limit = old - 1
+		reason = "idle"
+	}
+
+	limit = clamp(limit, options.Autoscale.Min, options.Autoscale.Max)
+	if limit == old {
+		return limit, false
+	}
+
+	this.limit = limit
+	this.decision = fmt.Sprintf("%d -> %d: %s", old, limit, reason)
+	this.decisionTime = time.Now()
+	return limit, true
+}
+
+// runAutoscaler 运行期间定时调整线程数，暂停时不调整
+func (this *Jobber) runAutoscaler(ctx context.Context) {
+	for {
+		interval := time.Duration(this.getOptions().Autoscale.Interval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		options := this.getOptions()
+		if !options.Autoscale.Enable || this.GetState() != RUNNING {
+			continue
+		}
+
+		this.chLock.Lock()
+		workers := this.workers
+		this.chLock.Unlock()
+
+		// 查询失败时不知道积压情况，只根据延迟调整
+		backlog := 0
+		if info := this.refreshQueueInfo(); info.Error == "" {
+			backlog = info.Messages
+		}
+
+		limit, changed := this.autoscaler.decide(options, workers.resetPeak(), backlog)
+		if !changed {
+			continue
+		}
+
+		workers.resize(limit)
+		decision := this.GetAutoscale().Decision
+		this.getLogger().Infof("Jobber autoscaled %s", decision)
+		Events.Add(EVENT_AUTOSCALE, SOURCE_AUTOSCALE, this.name, decision)
+	}
+}
+
+// SetAutoscale 手动开启或关闭自动调整，关闭后线程数保持不变，直到手动调整或者重新开启
+func (this *Jobber) SetAutoscale(enable bool) error {
+	options := this.getOptions()
+	if !options.Autoscale.Enable {
+		return errors.New(fmt.Sprintf("Autoscale of jobber %s is not configured", this.name))
+	}
+
+	size, _ := this.GetWorkerNum()
+
+	this.autoscaler.lock.Lock()
+	this.autoscaler.disabled = !enable
+	if enable {
+		// 从当前线程数开始继续调整
+		this.autoscaler.limit = size
+	}
+	this.autoscaler.lock.Unlock()
+
+	if !enable {
+		// 关闭后以当前线程数作为手动设置的线程数
+		this.lock.Lock()
+		this.options.WorkerNum = size
+		options = this.options
+		this.lock.Unlock()
+	}
+
+	// 重新开启后不再保持手动设置的线程数
+	Intents.set(this.name, func(intent *Intent) {
+		if enable {
+			intent.WorkerNum = 0
+		} else {
+			intent.WorkerNum = size
+		}
+	})
+
+	Events.Add(EVENT_AUTOSCALE, SOURCE_AUTOSCALE, this.name, fmt.Sprintf("autoscale enable=%t", enable))
+	return this.applyScale(options)
+}
+
+// disableAutoscale 手动调整线程数时关闭自动调整
+func (this *Jobber) disableAutoscale() {
+	this.autoscaler.lock.Lock()
+	defer this.autoscaler.lock.Unlock()
+
+	this.autoscaler.disabled = true
+}
+
+// poolSize 获取线程池应有的大小
+func (this *Jobber) poolSize(options jobberOptions) int {
+	this.autoscaler.lock.Lock()
+	defer this.autoscaler.lock.Unlock()
+
+	return this.autoscaler.size(options)
+}
+
+// qosPrefetch 获取 channel 的预取数量，自动调整中按最大线程数预取，调整线程数时不需要重新订阅，
+// 手动关闭自动调整或者手动调整线程数后按当前的线程数预取，否则多出的线程收不到消息
+func (this *Jobber) qosPrefetch(options jobberOptions) int {
+	this.autoscaler.lock.Lock()
+	active := options.Autoscale.Enable && !this.autoscaler.disabled
+	this.autoscaler.lock.Unlock()
+
+	workers := options.WorkerNum
+	if active {
+		workers = options.Autoscale.Max
+	}
+	return options.prefetch(workers)
+}
+
+// GetAutoscale 获取自动调整的状态
+func (this *Jobber) GetAutoscale() AutoscaleInfo {
+	options := this.getOptions()
+
+	this.autoscaler.lock.Lock()
+	defer this.autoscaler.lock.Unlock()
+
+	return AutoscaleInfo{
+		Enable:        options.Autoscale.Enable,
+		Active:        options.Autoscale.Enable && !this.autoscaler.disabled,
+		Min:           options.Autoscale.Min,
+		Max:           options.Autoscale.Max,
+		Limit:         this.autoscaler.limit,
+		TargetLatency: time.Duration(options.Autoscale.TargetLatency) * time.Millisecond,
+		Latency:       this.autoscaler.latency,
+		Backlog:       this.autoscaler.backlog,
+		Decision:      this.autoscaler.decision,
+		DecisionTime:  this.autoscaler.decisionTime,
+	}
+}
+
+func (this *jobberPools) SetAutoscale(name string, enable bool) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.SetAutoscale(enable)
+}
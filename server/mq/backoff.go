@@ -0,0 +1,83 @@
+package mq
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	random     = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomLock sync.Mutex
+)
+
+// randFloat 线程安全的随机数，返回 [0, 1)
+func randFloat() float64 {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Float64()
+}
+
+// randIntn 线程安全的随机数，返回 [0, n)
+func randIntn(n int) int {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return random.Intn(n)
+}
+
+// backoff 指数退避，每次失败等待时间翻倍，直到 max，并附加随机抖动
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	jitter  float64
+	attempt uint
+}
+
+func newBackoff(min, max time.Duration, jitter float64) *backoff {
+	if min <= 0 {
+		min = time.Second
+	}
+
+	if max < min {
+		max = min
+	}
+
+	if jitter < 0 {
+		jitter = 0
+	}
+
+	if jitter > 1 {
+		jitter = 1
+	}
+
+	return &backoff{
+		min:    min,
+		max:    max,
+		jitter: jitter,
+	}
+}
+
+// next 返回下一次重试前需要等待的时间
+func (this *backoff) next() time.Duration {
+	d := this.min
+	for i := uint(0); i < this.attempt && d < this.max; i++ {
+		d *= 2
+	}
+
+	if d > this.max {
+		d = this.max
+	}
+	this.attempt++
+
+	if this.jitter > 0 {
+		delta := float64(d) * this.jitter
+		d = time.Duration(float64(d) - delta + 2*delta*randFloat())
+	}
+
+	return d
+}
+
+// reset 连接成功后重置退避
+func (this *backoff) reset() {
+	this.attempt = 0
+}
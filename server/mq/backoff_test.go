@@ -0,0 +1,57 @@
+package mq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	cases := []struct {
+		name     string
+		min      time.Duration
+		max      time.Duration
+		attempts []time.Duration
+	}{
+		{"doubles until max", time.Second, 10 * time.Second, []time.Duration{
+			time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+		}},
+		{"min above max", 5 * time.Second, time.Second, []time.Duration{5 * time.Second, 5 * time.Second}},
+		{"zero min", 0, 3 * time.Second, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+	}
+
+	for _, c := range cases {
+		b := newBackoff(c.min, c.max, 0)
+		for i, want := range c.attempts {
+			if got := b.next(); got != want {
+				t.Errorf("%s: attempt %d = %s, want %s", c.name, i, got, want)
+			}
+		}
+
+		b.reset()
+		if got := b.next(); got != c.attempts[0] {
+			t.Errorf("%s: after reset = %s, want %s", c.name, got, c.attempts[0])
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	cases := []struct {
+		jitter float64
+		lower  time.Duration
+		upper  time.Duration
+	}{
+		{0.5, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{2, 0, 2 * time.Second},
+		{-1, time.Second, time.Second},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 100; i++ {
+			b := newBackoff(time.Second, time.Minute, c.jitter)
+			if got := b.next(); got < c.lower || got > c.upper {
+				t.Errorf("jitter %.1f: next = %s, want in [%s, %s]", c.jitter, got, c.lower, c.upper)
+				break
+			}
+		}
+	}
+}
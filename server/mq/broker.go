@@ -0,0 +1,144 @@
+package mq
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ROUNDROBIN = "roundrobin"
+	RANDOM     = "random"
+)
+
+// BrokerHealth broker 的健康状态
+type BrokerHealth struct {
+	Addr                string
+	Connected           bool
+	Connections         int
+	Blocked             bool
+	BlockedReason       string
+	LastError           string
+	LastErrorTime       time.Time
+	LastConnected       time.Time
+	LastDisconnected    time.Time
+	Failures            int64
+	ConsecutiveFailures int64
+}
+
+type brokerPools struct {
+	lock     sync.Mutex
+	strategy string
+	next     int
+	brokers  []*BrokerHealth
+}
+
+func (this *brokerPools) init(addrs []string, strategy string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.strategy = strategy
+	this.next = 0
+	this.brokers = make([]*BrokerHealth, 0, len(addrs))
+	for _, addr := range addrs {
+		this.brokers = append(this.brokers, &BrokerHealth{Addr: addr})
+	}
+}
+
+// pick 按照选择策略返回下一个尝试连接的 broker
+func (this *brokerPools) pick() string {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if len(this.brokers) == 0 {
+		return ""
+	}
+
+	var i int
+	switch this.strategy {
+	case RANDOM:
+		i = randIntn(len(this.brokers))
+	default:
+		i = this.next % len(this.brokers)
+		this.next = i + 1
+	}
+
+	return this.brokers[i].Addr
+}
+
+func (this *brokerPools) get(addr string) *BrokerHealth {
+	for _, b := range this.brokers {
+		if b.Addr == addr {
+			return b
+		}
+	}
+	return nil
+}
+
+func (this *brokerPools) connected(addr string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if b := this.get(addr); b != nil {
+		b.Connections++
+		b.Connected = true
+		b.LastConnected = time.Now()
+		b.ConsecutiveFailures = 0
+	}
+}
+
+func (this *brokerPools) failed(addr string, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if b := this.get(addr); b != nil {
+		b.Failures++
+		b.ConsecutiveFailures++
+		if err != nil {
+			b.LastError = err.Error()
+			b.LastErrorTime = time.Now()
+		}
+	}
+}
+
+func (this *brokerPools) disconnected(addr string, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if b := this.get(addr); b != nil {
+		if b.Connections > 0 {
+			b.Connections--
+		}
+		b.Connected = b.Connections > 0
+		if !b.Connected {
+			b.Blocked = false
+			b.BlockedReason = ""
+		}
+		b.LastDisconnected = time.Now()
+		if err != nil {
+			b.LastError = err.Error()
+			b.LastErrorTime = b.LastDisconnected
+		}
+	}
+}
+
+func (this *brokerPools) blocked(addr string, active bool, reason string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if b := this.get(addr); b != nil {
+		b.Blocked = active
+		b.BlockedReason = reason
+	}
+}
+
+// List 获取所有 broker 的健康状态
+func (this *brokerPools) List() []BrokerHealth {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	list := make([]BrokerHealth, 0, len(this.brokers))
+	for _, b := range this.brokers {
+		list = append(list, *b)
+	}
+	return list
+}
@@ -6,115 +6,169 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
-	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type connection struct {
-	status int32
-	conn   *amqp.Connection
-	ctx    context.Context
-	cancle context.CancelFunc
-	once   sync.Once
+	id       int
+	status   int32
+	jobbers  int32
+	connects int64 // 连接成功的次数
+	addr     string
+	conn     *amqp.Connection
+	ctx      context.Context
+	cancle   context.CancelFunc
 }
 
+func (this *connection) dial(addr string) (*amqp.Connection, error) {
+	config := amqp.Config{
+		Heartbeat:       Options.Heartbeat,
+		Locale:          "en_US",
+		TLSClientConfig: Options.TLS.clientConfig(),
+	}
+
+	// 用户名密码不拼接到 URL 中，secret 中的 @ # / % ? 等字符不需要转义
+	if Options.TLS.External {
+		// EXTERNAL 认证由客户端证书确定身份
+		config.SASL = []amqp.Authentication{&externalAuth{}}
+	} else {
+		config.SASL = []amqp.Authentication{&amqp.PlainAuth{
+			Username: Options.User,
+			Password: Options.Pswd,
+		}}
+	}
+
+	u := fmt.Sprintf(
+		"%s://%s%s",
+		Options.TLS.scheme(),
+		addr,
+		Options.Vhost,
+	)
+
+	return amqp.DialConfig(u, config)
+}
+
+// connect 按照选择策略依次尝试每个 broker，直到有一个连接成功
 func (this *connection) connect() error {
-	logrus.Info("Try to connect rabbitMQ server.")
-
-	dial := func(addr string) (*amqp.Connection, error) {
-		u := fmt.Sprintf(
-			"amqp://%s:%s@%s%s",
-			Options.User,
-			Options.Pswd,
-			addr,
-			Options.Vhost,
-		)
-		conn, err := amqp.Dial(u)
-		return conn, err
+	logrus.Infof("Connection #%d try to connect rabbitMQ server.", this.id)
+
+	if len(Options.Brokers) == 0 {
+		return errors.New("No rabbitMQ broker configured.")
 	}
 
-	var conn *amqp.Connection
 	var err error
-	for _, host := range Options.Brokers {
-		conn, err = dial(host)
-		if err == nil {
-			atomic.StoreInt32(&this.status, 1)
-			this.conn = conn
-			break
+	for i := 0; i < len(Options.Brokers); i++ {
+		addr := Brokers.pick()
+
+		var conn *amqp.Connection
+		conn, err = this.dial(addr)
+		if err != nil {
+			Brokers.failed(addr, err)
+			logrus.Warnf("Connection #%d connect rabbitMQ server %s failed with error: %s", this.id, addr, err.Error())
+			continue
 		}
+
+		Brokers.connected(addr)
+		this.addr = addr
+		this.conn = conn
+		atomic.StoreInt32(&this.status, 1)
+		atomic.AddInt64(&this.connects, 1)
+		break
 	}
 
 	if err != nil {
 		return err
 	}
 
-	atomic.StoreInt32(&this.status, 1)
-	this.conn = conn
+	// 只启动分配在当前连接上的 jobber：因断线退出的，以及配置了 autostart 且从未启动过的，
+	// 重启前手动停止的不启动
+	for _, jb := range Jobbers.List() {
+		if jb.conn != this {
+			continue
+		}
 
-	vals := Jobbers.jobbers.Values()
-	for _, val := range vals {
-		jb := val.(*Jobber)
-		status, _ := jb.GetStatus()
-		if status == -1 {
-			Jobbers.Start(jb.name)
+		state := jb.GetState()
+		if state == FATAL {
+			Jobbers.start(jb.name)
+		} else if state == STOPPED && jb.GetStartTime().IsZero() && jb.getOptions().autostart() && !Intents.stopped(jb.name) {
+			Jobbers.start(jb.name)
 		}
 	}
 
-	logrus.Info("Connect rabbitMQ server success.")
+	logrus.Infof("Connection #%d connect rabbitMQ server %s success.", this.id, this.addr)
 	return nil
 }
 
+// run 连接的守护进程，断线后按指数退避重连，直到 ctx 结束
 func (this *connection) run(ctx context.Context) {
-	defer func() {
-		if err := recover(); err != nil {
-			switch err.(type) {
-			case error:
-				logrus.Panicln("RabbitMQ connection has disconnected with error: ", err.(error).Error())
-			}
-		}
-	}()
-
 	ctx, cancle := context.WithCancel(ctx)
 	this.ctx = ctx
 	this.cancle = cancle
 
-	for this.status == 0 {
-		this.connect()
-		time.Sleep(2 * time.Second)
+	retry := newBackoff(Options.Reconnect.Min, Options.Reconnect.Max, Options.Reconnect.Jitter)
+	for {
+		if err := this.connect(); err != nil {
+			wait := retry.next()
+			logrus.Errorf("Connection #%d connect rabbitMQ server failed, retry in %s", this.id, wait)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+		retry.reset()
+
+		if !this.wait() {
+			return
+		}
 	}
+}
+
+// wait 阻塞直到连接断开，返回 false 表示连接是被主动关闭的，不需要重连
+func (this *connection) wait() bool {
+	closes := this.conn.NotifyClose(make(chan *amqp.Error, 1))
+	blocks := this.conn.NotifyBlocked(make(chan amqp.Blocking, 1))
 
-	notify := make(chan *amqp.Error)
-RETRY:
 	for {
 		select {
 		case <-this.ctx.Done():
 			this.close()
-		case err, flag := <-this.conn.NotifyClose(notify):
-			atomic.StoreInt32(&this.status, 0)
-
-			Jobbers.StopAll()
+			return false
+		case b, ok := <-blocks:
+			if !ok {
+				// 连接关闭时会关闭 blocks，由 closes 处理断线
+				blocks = nil
+				continue
+			}
 
-			if !flag {
-				logrus.Errorf("RabbitMQ connection has went away")
-				return
+			Brokers.blocked(this.addr, b.Active, b.Reason)
+			if b.Active {
+				logrus.Warnf("RabbitMQ server %s blocked connection #%d: %s", this.addr, this.id, b.Reason)
+			} else {
+				logrus.Infof("RabbitMQ server %s unblocked connection #%d", this.addr, this.id)
 			}
+		case err, ok := <-closes:
+			atomic.StoreInt32(&this.status, 0)
 
-			if err != nil {
-				logrus.Errorln("Closed by notify from RabbitMQ with error: ", err)
-				break RETRY
+			if !ok || err == nil {
+				Brokers.disconnected(this.addr, nil)
+				logrus.Errorf("Connection #%d to %s has went away", this.id, this.addr)
 			} else {
-				logrus.Infoln("Closed by notify from RabbitMQ")
-				return
+				Brokers.disconnected(this.addr, err)
+				logrus.Errorf("Connection #%d closed by notify from RabbitMQ with error: %s", this.id, err.Error())
 			}
+
+			// jobber 的 channel 随连接一起关闭，会以 FATAL 状态退出，重连成功后重新启动
+			return true
 		}
 	}
-
-	go this.run(this.ctx)
 }
 
 func (this *connection) getChannel() (*amqp.Channel, error) {
-	if this.status == 0 {
+	if atomic.LoadInt32(&this.status) == 0 {
 		return nil, errors.New("RabbitMQ has not connected.")
 	}
 	channel, err := this.conn.Channel()
@@ -122,5 +176,40 @@ func (this *connection) getChannel() (*amqp.Channel, error) {
 }
 
 func (this *connection) close() {
-	this.conn.Close()
+	if atomic.CompareAndSwapInt32(&this.status, 1, 0) {
+		this.conn.Close()
+		Brokers.disconnected(this.addr, nil)
+	}
+}
+
+// GetId 获取连接编号
+func (this *connection) GetId() int {
+	return this.id
+}
+
+// GetStatus 获取连接状态
+func (this *connection) GetStatus() (int32, string) {
+	s := atomic.LoadInt32(&this.status)
+	if s == 1 {
+		return s, "CONNECTED"
+	}
+	return s, "DISCONNECTED"
+}
+
+// GetAddr 获取当前连接的 broker
+func (this *connection) GetAddr() string {
+	return this.addr
+}
+
+// GetReconnects 获取第一次连接成功之后重连成功的次数
+func (this *connection) GetReconnects() int64 {
+	if n := atomic.LoadInt64(&this.connects); n > 1 {
+		return n - 1
+	}
+	return 0
+}
+
+// GetJobberNum 获取分配在当前连接上的 jobber 数量
+func (this *connection) GetJobberNum() int {
+	return int(atomic.LoadInt32(&this.jobbers))
 }
@@ -0,0 +1,76 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// connectionPools 连接池，每个连接独立重连，jobber 分散在各个连接上
+type connectionPools struct {
+	lock  sync.Mutex
+	conns []*connection
+}
+
+func (this *connectionPools) init(size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.conns = make([]*connection, 0, size)
+	for i := 0; i < size; i++ {
+		this.conns = append(this.conns, &connection{id: i})
+	}
+}
+
+func (this *connectionPools) run(ctx context.Context) {
+	for _, c := range this.conns {
+		go c.run(ctx)
+	}
+}
+
+// assign 为 jobber 分配 jobber 数量最少的连接
+func (this *connectionPools) assign() *connection {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	var conn *connection
+	for _, c := range this.conns {
+		if conn == nil || atomic.LoadInt32(&c.jobbers) < atomic.LoadInt32(&conn.jobbers) {
+			conn = c
+		}
+	}
+
+	atomic.AddInt32(&conn.jobbers, 1)
+	return conn
+}
+
+// release jobber 被移除后释放占用的连接
+func (this *connectionPools) release(conn *connection) {
+	if conn != nil {
+		atomic.AddInt32(&conn.jobbers, -1)
+	}
+}
+
+// List 获取所有连接
+func (this *connectionPools) List() []*connection {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	list := make([]*connection, len(this.conns))
+	copy(list, this.conns)
+	return list
+}
+
+// close 停止重连并关闭所有连接
+func (this *connectionPools) close() {
+	for _, c := range this.List() {
+		if c.cancle != nil {
+			c.cancle()
+		}
+		c.close()
+	}
+}
@@ -0,0 +1,99 @@
+package mq
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// FieldDiff 一个配置字段的变化
+type FieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// optionsHash 计算解析后配置的哈希，只包含导出的字段，
+// 配置文件内容的格式、注释以及修改时间不影响结果
+func optionsHash(options jobberOptions) string {
+	b, err := json.Marshal(options)
+	if err != nil {
+		return ""
+	}
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// diffFields 逐字段比较新旧配置，嵌套的字段以 . 连接，如 queue.name，
+// 变化的值按 redacted 展示，引用的环境变量和 secret 的值变化时只展示引用本身
+func diffFields(old, new jobberOptions) []FieldDiff {
+	ro, rn := old.redacted(), new.redacted()
+	return appendDiffs(make([]FieldDiff, 0), "", reflect.ValueOf(old), reflect.ValueOf(new), reflect.ValueOf(ro), reflect.ValueOf(rn))
+}
+
+// appendDiffs 比较 ov 和 nv，变化的字段用 ro 和 rn 中对应的值展示
+func appendDiffs(diffs []FieldDiff, prefix string, ov, nv, ro, rn reflect.Value) []FieldDiff {
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key := prefix + optionKey(field)
+		if field.Type.Kind() == reflect.Struct {
+			diffs = appendDiffs(diffs, key+".", ov.Field(i), nv.Field(i), ro.Field(i), rn.Field(i))
+			continue
+		}
+
+		o := ov.Field(i).Interface()
+		n := nv.Field(i).Interface()
+		if !reflect.DeepEqual(o, n) {
+			diff := FieldDiff{
+				Field: key,
+				Old:   formatValue(ro.Field(i)),
+				New:   formatValue(rn.Field(i)),
+			}
+			if diff.Old == diff.New {
+				diff.New += " (resolved value changed)"
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+// formatValue 格式化配置的值，字符串加引号以区分空值
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "null"
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// Diffs 获取 Reread 得到的变化中已存在的 jobber 的字段变化，新增的 jobber 没有变化
+func (this *jobberPools) Diffs() map[string][]FieldDiff {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	diffs := make(map[string][]FieldDiff)
+	for name, op := range this.changed {
+		jb, err := this.get(name)
+		if err != nil {
+			continue
+		}
+		// 和 Update 一样，手动调整的线程数和限速不会被配置覆盖
+		diffs[name] = diffFields(jb.getOptions(), Intents.override(op))
+	}
+	return diffs
+}
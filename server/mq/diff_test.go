@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// parsed 校验 yaml 配置并返回解析后的配置，配置无效时测试失败
+func parsed(t *testing.T, content string) jobberOptions {
+	report := validateContent("a.yaml", []byte(content))
+	if !report.Valid() {
+		t.Fatalf("invalid config: %s", report.Error())
+	}
+	return report.options
+}
+
+func TestOptionsHashChange(t *testing.T) {
+	os.Setenv("JOBBER_DIFF_HOST", "127.0.0.1")
+	defer os.Unsetenv("JOBBER_DIFF_HOST")
+
+	base := strings.Replace(validYaml, "127.0.0.1:8082", "${JOBBER_DIFF_HOST}:8082", 1)
+
+	cases := []struct {
+		name    string
+		content string
+		env     string
+		changed bool
+	}{
+		{"same content", base, "127.0.0.1", false},
+		{"comment added", "# comment\n" + base, "127.0.0.1", false},
+		{"keys reordered", strings.Replace(base, "workernum: 4\n", "", 1) + "workernum: 4\n", "127.0.0.1", false},
+		{"default written out", base + "channels: 1\n", "127.0.0.1", false},
+		{"value changed", strings.Replace(base, "workernum: 4", "workernum: 5", 1), "127.0.0.1", true},
+		{"nested value changed", strings.Replace(base, "type: fanout", "type: direct", 1), "127.0.0.1", true},
+		{"referenced env changed", base, "10.0.0.1", true},
+	}
+
+	old := parsed(t, base).configFile.hash
+	for _, c := range cases {
+		os.Setenv("JOBBER_DIFF_HOST", c.env)
+		hash := parsed(t, c.content).configFile.hash
+		if changed := hash != old; changed != c.changed {
+			t.Errorf("%s: changed = %t, want %t", c.name, changed, c.changed)
+		}
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	os.Setenv("JOBBER_DIFF_HOST", "127.0.0.1")
+	defer os.Unsetenv("JOBBER_DIFF_HOST")
+
+	base := strings.Replace(validYaml, "127.0.0.1:8082", "${JOBBER_DIFF_HOST}:8082", 1)
+
+	cases := []struct {
+		name    string
+		content string
+		env     string
+		diffs   []FieldDiff
+	}{
+		{"unchanged", base, "127.0.0.1", []FieldDiff{}},
+		{"top level", strings.Replace(base, "workernum: 4", "workernum: 8", 1), "127.0.0.1", []FieldDiff{
+			{Field: "workernum", Old: "4", New: "8"},
+		}},
+		{"nested", strings.Replace(base, "type: fanout", "type: direct", 1), "127.0.0.1", []FieldDiff{
+			{Field: "exchange.type", Old: `"fanout"`, New: `"direct"`},
+		}},
+		{"reference changed", strings.Replace(base, "${JOBBER_DIFF_HOST}", "${JOBBER_DIFF_OTHER:-localhost}", 1), "127.0.0.1", []FieldDiff{
+			{Field: "url", Old: `"http://${JOBBER_DIFF_HOST}:8082/index.php"`, New: `"http://${JOBBER_DIFF_OTHER:-localhost}:8082/index.php"`},
+		}},
+		{"resolved value changed", base, "10.0.0.1", []FieldDiff{
+			{Field: "url", Old: `"http://${JOBBER_DIFF_HOST}:8082/index.php"`, New: `"http://${JOBBER_DIFF_HOST}:8082/index.php" (resolved value changed)`},
+		}},
+	}
+
+	old := parsed(t, base)
+	for _, c := range cases {
+		os.Setenv("JOBBER_DIFF_HOST", c.env)
+		diffs := diffFields(old, parsed(t, c.content))
+		if len(diffs) != len(c.diffs) {
+			t.Errorf("%s: got diffs %v, want %v", c.name, diffs, c.diffs)
+			continue
+		}
+		for i := range diffs {
+			if diffs[i] != c.diffs[i] {
+				t.Errorf("%s: diff %d = %v, want %v", c.name, i, diffs[i], c.diffs[i])
+			}
+		}
+	}
+}
+
+func TestRereadChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reread")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "jobber.yaml")
+	if err := ioutil.WriteFile(config, []byte("include: "+filepath.Join(dir, "*.yml")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(config)
+	defer viper.Reset()
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name    string
+		edit    func()
+		changed []string
+		removed []string
+	}{
+		{"untouched", func() {}, []string{}, []string{}},
+		{"only comments and mtime", func() {
+			write("a.yml", "# comment\n"+jobberYaml("a", "qa", "c", "e", "fanout"))
+		}, []string{}, []string{}},
+		{"value changed", func() {
+			write("a.yml", strings.Replace(jobberYaml("a", "qa", "c", "e", "fanout"), "workernum: 4", "workernum: 6", 1))
+		}, []string{"a"}, []string{}},
+		{"added", func() {
+			write("c.yml", jobberYaml("c", "qc", "c", "e", "fanout"))
+		}, []string{"c"}, []string{}},
+		{"removed", func() {
+			os.Remove(filepath.Join(dir, "b.yml"))
+		}, []string{}, []string{"b"}},
+		{"invalid file is kept", func() {
+			write("b.yml", jobberYaml("b", "qb", "c", "e", "fanout")+"unknown: 1\n")
+		}, []string{}, []string{}},
+	}
+
+	for _, c := range cases {
+		write("a.yml", jobberYaml("a", "qa", "c", "e", "fanout"))
+		write("b.yml", jobberYaml("b", "qb", "c", "e", "fanout"))
+		os.Remove(filepath.Join(dir, "c.yml"))
+
+		pools := &jobberPools{jobbers: make(map[string]*Jobber)}
+		ops, _, err := pools.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, op := range ops {
+			pools.jobbers[name] = &Jobber{name: name, options: op}
+		}
+
+		c.edit()
+		changed, removed, _, err := pools.Reread()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(changed, c.changed) || !reflect.DeepEqual(removed, c.removed) {
+			t.Errorf("%s: changed %v removed %v, want %v %v", c.name, changed, removed, c.changed, c.removed)
+		}
+	}
+}
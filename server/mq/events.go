@@ -0,0 +1,62 @@
+package mq
+
+import (
+	"sync"
+	"time"
+)
+
+const maxEvents = 500
+
+// Event 服务运行中发生的事件，例如配置自动更新
+type Event struct {
+	Id      int64
+	Time    time.Time
+	Type    string
+	Source  string
+	Jobber  string
+	Message string
+}
+
+type eventPools struct {
+	lock   sync.Mutex
+	lastId int64
+	events []Event
+}
+
+// Add 记录一个事件，只保留最近的 maxEvents 个
+func (this *eventPools) Add(etype, source, jobber, message string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.lastId++
+	this.events = append(this.events, Event{
+		Id:      this.lastId,
+		Time:    time.Now(),
+		Type:    etype,
+		Source:  source,
+		Jobber:  jobber,
+		Message: message,
+	})
+
+	if len(this.events) > maxEvents {
+		this.events = this.events[len(this.events)-maxEvents:]
+	}
+}
+
+// List 获取 id 大于 since 的事件，最多返回最近的 limit 个
+func (this *eventPools) List(since int64, limit int) []Event {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	list := make([]Event, 0)
+	for _, e := range this.events {
+		if e.Id > since {
+			list = append(list, e)
+		}
+	}
+
+	if limit > 0 && len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return list
+}
@@ -0,0 +1,195 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	FORMAT_YAML = "yaml"
+	FORMAT_JSON = "json"
+	FORMAT_TOML = "toml"
+
+	// FORMAT_INLINE jobber.yaml 中 jobbers 列表里的 jobber
+	FORMAT_INLINE = "inline"
+)
+
+// formats 支持的配置文件扩展名
+var formats = map[string]string{
+	".yaml": FORMAT_YAML,
+	".yml":  FORMAT_YAML,
+	".json": FORMAT_JSON,
+	".toml": FORMAT_TOML,
+}
+
+var (
+	tomlLine   = regexp.MustCompile(`^\((\d+), \d+\): (.*)$`)
+	inlineFile = regexp.MustCompile(`#jobbers\[\d+\]$`)
+)
+
+// fileFormat 按扩展名获取配置文件的格式，不支持的格式返回空
+func fileFormat(file string) string {
+	if isInline(file) {
+		return FORMAT_INLINE
+	}
+	return formats[strings.ToLower(filepath.Ext(file))]
+}
+
+// isInline 是否是 jobber.yaml 中 jobbers 列表里的 jobber
+func isInline(file string) bool {
+	return inlineFile.MatchString(file)
+}
+
+// includePatterns 获取 include 配置，可以是一个或者多个 glob
+func includePatterns() ([]string, error) {
+	patterns := viper.GetStringSlice("include")
+	if len(patterns) == 0 {
+		return nil, errors.New("Jobber config path is empty.")
+	}
+	return patterns, nil
+}
+
+// includeMatch 文件是否匹配 include 并且是支持的格式
+func includeMatch(file string) bool {
+	if fileFormat(file) == "" || isInline(file) {
+		return false
+	}
+
+	patterns, _ := includePatterns()
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// includeFiles 获取 include 匹配的所有支持格式的配置文件，按路径排序
+func includeFiles() ([]string, error) {
+	patterns, err := includePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		match, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range match {
+			if !seen[file] && fileFormat(file) != "" {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// inlineJobbers 获取 jobber.yaml 中 jobbers 列表里的 jobber，转换为 yaml 后和配置文件一起加载，
+// 名称为 <jobber.yaml 路径>#jobbers[<序号>]
+func inlineJobbers() (map[string][]byte, error) {
+	contents := make(map[string][]byte)
+
+	list, ok := viper.Get("jobbers").([]interface{})
+	if !ok {
+		return contents, nil
+	}
+
+	// 引用在校验时和配置文件一样只替换一次，这里保持原样
+	for i, item := range list {
+		file := fmt.Sprintf("%s#jobbers[%d]", viper.ConfigFileUsed(), i)
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid jobber %s: %s", file, err.Error()))
+		}
+		contents[file] = b
+	}
+	return contents, nil
+}
+
+// toYaml 把配置转换为 yaml，json 是 yaml 的子集可以直接解析，toml 先解析后再转换
+func toYaml(format string, content []byte) ([]byte, error) {
+	if format != FORMAT_TOML {
+		return content, nil
+	}
+
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(tree.ToMap())
+}
+
+// tomlIssues 把 toml 的解析错误转换为问题列表，错误中的行号转换为 Line
+func tomlIssues(err error) []Issue {
+	issue := Issue{Message: err.Error()}
+	if m := tomlLine.FindStringSubmatch(issue.Message); m != nil {
+		issue.Line, _ = strconv.Atoi(m[1])
+		issue.Message = m[2]
+	}
+	return []Issue{issue}
+}
+
+// fieldLine 按配置的格式查找字段所在的行号，jobbers 列表里的 jobber 无法定位
+func fieldLine(format string, content []byte, path string) int {
+	switch format {
+	case FORMAT_YAML:
+		return keyLine(content, path)
+	case FORMAT_JSON:
+		return jsonKeyLine(content, path)
+	case FORMAT_TOML:
+		return tomlKeyLine(content, path)
+	}
+	return 0
+}
+
+// jsonKeyLine 依次查找路径上的每个字段，字段不存在时返回最近的上级字段所在行
+func jsonKeyLine(content []byte, path string) int {
+	lines := strings.Split(string(content), "\n")
+
+	found, start := 0, 0
+	for _, key := range strings.Split(path, ".") {
+		re := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:`)
+
+		hit := false
+		for i := start; i < len(lines); i++ {
+			if re.MatchString(lines[i]) {
+				found, start, hit = i+1, i, true
+				break
+			}
+		}
+		if !hit {
+			break
+		}
+	}
+	return found
+}
+
+// tomlKeyLine 查找字段在 toml 中的行号，字段不存在时返回最近的上级字段所在行
+func tomlKeyLine(content []byte, path string) int {
+	tree, err := toml.LoadBytes(content)
+	if err != nil {
+		return 0
+	}
+
+	keys := strings.Split(path, ".")
+	for n := len(keys); n > 0; n-- {
+		if pos := tree.GetPositionPath(keys[:n]); !pos.Invalid() {
+			return pos.Line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,263 @@
+package mq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	SOURCE_INIT    = "init"
+	SOURCE_API     = "api"
+	SOURCE_CONSOLE = "console"
+)
+
+// VersionChange 一个版本中一个 jobber 的变化
+type VersionChange struct {
+	Name   string
+	Action string
+	Diffs  []FieldDiff
+	Error  string
+}
+
+// Version 每次应用配置变化后的快照，包括生效的 jobber 配置和 include 目录下配置文件的内容，
+// 回滚时恢复配置文件的内容，jobber.yaml 中的 defaults 和模板不会回滚，
+// 配置中的引用保持原样，不保存环境变量和 secret 的值
+type Version struct {
+	Id       int64
+	Time     time.Time
+	Source   string
+	Rollback int64 // 回滚到的版本，不是回滚时为 0
+	Changes  []VersionChange
+	Options  map[string]jobberOptions
+	Files    map[string]string
+}
+
+// Configs 获取版本中每个 jobber 生效的配置，yaml 格式
+func (this Version) Configs() map[string]string {
+	configs := make(map[string]string)
+	for name, options := range this.Options {
+		b, err := yaml.Marshal(options)
+		if err != nil {
+			configs[name] = err.Error()
+			continue
+		}
+		configs[name] = string(b)
+	}
+	return configs
+}
+
+type historyStore struct {
+	lock     sync.Mutex
+	path     string // 为空时只保存在内存中
+	max      int
+	lastId   int64
+	versions []Version
+}
+
+// init 加载保存的历史版本，配置文件和最后一个版本不同时记录当前配置作为新的版本
+func (this *historyStore) init(path string, max int) error {
+	this.lock.Lock()
+	this.path = path
+	this.max = max
+
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			this.lock.Unlock()
+			return err
+		}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &this.versions); err != nil {
+				this.lock.Unlock()
+				return errors.New(fmt.Sprintf("Load config history %s failed: %s", path, err.Error()))
+			}
+		}
+	}
+	if len(this.versions) > 0 {
+		this.lastId = this.versions[len(this.versions)-1].Id
+	}
+	this.lock.Unlock()
+
+	files, err := snapshotFiles()
+	if err != nil {
+		return err
+	}
+	if last, err := this.last(); err == nil && sameFiles(last.Files, files) {
+		return nil
+	}
+
+	this.add(SOURCE_INIT, 0, nil)
+	return nil
+}
+
+// add 记录一个新版本，保存失败只记录日志，不影响已经应用的变化
+func (this *historyStore) add(source string, rollback int64, changes []VersionChange) {
+	files, err := snapshotFiles()
+	if err != nil {
+		logrus.Errorf("Snapshot jobber config files failed with error: %s", err.Error())
+	}
+
+	options := make(map[string]jobberOptions)
+	for _, jb := range Jobbers.List() {
+		options[jb.name] = jb.getOptions().redacted()
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.lastId++
+	this.versions = append(this.versions, Version{
+		Id:       this.lastId,
+		Time:     time.Now(),
+		Source:   source,
+		Rollback: rollback,
+		Changes:  changes,
+		Options:  options,
+		Files:    files,
+	})
+
+	if this.max > 0 && len(this.versions) > this.max {
+		this.versions = this.versions[len(this.versions)-this.max:]
+	}
+
+	if err := this.save(); err != nil {
+		logrus.Errorf("Save config history %s failed with error: %s", this.path, err.Error())
+	}
+}
+
+func (this *historyStore) save() error {
+	if this.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(this.versions)
+	if err != nil {
+		return err
+	}
+	return writeFile(this.path, b)
+}
+
+func (this *historyStore) last() (Version, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if len(this.versions) == 0 {
+		return Version{}, errors.New("No config history")
+	}
+	return this.versions[len(this.versions)-1], nil
+}
+
+// List 获取最近的 limit 个版本，按版本号从小到大排序
+func (this *historyStore) List(limit int) []Version {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	list := this.versions
+	if limit > 0 && len(list) > limit {
+		list = list[len(list)-limit:]
+	}
+	return append([]Version{}, list...)
+}
+
+// Get 按版本号获取一个版本
+func (this *historyStore) Get(id int64) (Version, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for _, v := range this.versions {
+		if v.Id == id {
+			return v, nil
+		}
+	}
+	return Version{}, errors.New(fmt.Sprintf("Not found config version %d", id))
+}
+
+// snapshotFiles 读取 include 目录下所有配置文件的内容
+func snapshotFiles() (map[string]string, error) {
+	match, err := includeFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, file := range match {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		files[file] = string(content)
+	}
+	return files, nil
+}
+
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, content := range a {
+		if c, found := b[file]; !found || c != content {
+			return false
+		}
+	}
+	return true
+}
+
+// Rollback 把 include 目录下的配置文件恢复为指定版本的内容，删除该版本之后新增的配置文件，然后应用变化
+func (this *jobberPools) Rollback(id int64, source string) ([]UpdateResult, error) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	version, err := History.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if version.Files == nil {
+		return nil, errors.New(fmt.Sprintf("Config version %d has no snapshot of config files", id))
+	}
+
+	for file := range version.Files {
+		if !includeMatch(file) {
+			return nil, errors.New(fmt.Sprintf("Config file %s of version %d does not match include", file, id))
+		}
+	}
+
+	current, err := includeFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for file, content := range version.Files {
+		if b, err := ioutil.ReadFile(file); err == nil && bytes.Equal(b, []byte(content)) {
+			continue
+		}
+		if err := writeFile(file, []byte(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range current {
+		if _, found := version.Files[file]; found {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return nil, err
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, _, _, err := this.reread(); err != nil {
+		return nil, err
+	}
+	return this.updateAll(source, id), nil
+}
@@ -2,8 +2,9 @@ package mq
 
 import (
 	"context"
-	"github.com/emirpasic/gods/maps/hashmap"
 	"github.com/spf13/viper"
+	"gitlab.mydadao.com/marketing/message_jobber/config"
+	"time"
 )
 
 const (
@@ -13,8 +14,8 @@ const (
 
 var (
 	Jobbers = &jobberPools{
-		jobbers: hashmap.New(),
-		changed: hashmap.New(),
+		jobbers: make(map[string]*Jobber),
+		changed: make(map[string]jobberOptions),
 	}
 
 	Options = struct {
@@ -22,20 +23,99 @@ var (
 		User    string
 		Pswd    string
 		Vhost   string
+		TLS     tlsOptions
+
+		// 心跳间隔，小于 1s 时使用服务端的设置
+		Heartbeat time.Duration
+
+		// 定时刷新队列状态的间隔，为 0 时每次查询状态都实时获取
+		InspectInterval time.Duration
+
+		// 断线重连的策略
+		Reconnect struct {
+			Strategy string
+			Min      time.Duration
+			Max      time.Duration
+			Jitter   float64
+		}
 	}{}
 
-	Connection = new(connection)
+	Brokers = new(brokerPools)
+
+	Events = new(eventPools)
+
+	History = new(historyStore)
+
+	Intents = new(intentStore)
+
+	Connections = new(connectionPools)
 )
 
 func Init(ctx context.Context) error {
 	Options.Brokers = viper.GetStringSlice("server.rabbitmq.brokers")
-	Options.User = viper.GetString("server.rabbitmq.user")
-	Options.Pswd = viper.GetString("server.rabbitmq.pswd")
+	// 用户名和密码支持 ${ENV}、${file:path}、${secret:name} 引用，避免把密码提交到代码库
+	user, err := config.Expand(viper.GetString("server.rabbitmq.user"))
+	if err != nil {
+		return err
+	}
+	pswd, err := config.Expand(viper.GetString("server.rabbitmq.pswd"))
+	if err != nil {
+		return err
+	}
+	Options.User = user
+	Options.Pswd = pswd
 	Options.Vhost = viper.GetString("server.rabbitmq.vhost")
+	Options.TLS.Enable = viper.GetBool("server.rabbitmq.tls.enable")
+	Options.TLS.CaFile = viper.GetString("server.rabbitmq.tls.cafile")
+	Options.TLS.CertFile = viper.GetString("server.rabbitmq.tls.certfile")
+	Options.TLS.KeyFile = viper.GetString("server.rabbitmq.tls.keyfile")
+	Options.TLS.ServerName = viper.GetString("server.rabbitmq.tls.servername")
+	Options.TLS.SkipVerify = viper.GetBool("server.rabbitmq.tls.skipverify")
+	Options.TLS.External = viper.GetBool("server.rabbitmq.tls.external")
+	if err := Options.TLS.load(); err != nil {
+		return err
+	}
+
+	viper.SetDefault("server.rabbitmq.heartbeat", 10)
+	viper.SetDefault("server.rabbitmq.reconnect.strategy", ROUNDROBIN)
+	viper.SetDefault("server.rabbitmq.reconnect.min", 1)
+	viper.SetDefault("server.rabbitmq.reconnect.max", 60)
+	viper.SetDefault("server.rabbitmq.reconnect.jitter", 0.2)
+	Options.Heartbeat = time.Duration(viper.GetInt("server.rabbitmq.heartbeat")) * time.Second
+	Options.Reconnect.Strategy = viper.GetString("server.rabbitmq.reconnect.strategy")
+	Options.Reconnect.Min = time.Duration(viper.GetFloat64("server.rabbitmq.reconnect.min") * float64(time.Second))
+	Options.Reconnect.Max = time.Duration(viper.GetFloat64("server.rabbitmq.reconnect.max") * float64(time.Second))
+	Options.Reconnect.Jitter = viper.GetFloat64("server.rabbitmq.reconnect.jitter")
+	Brokers.init(Options.Brokers, Options.Reconnect.Strategy)
+
+	viper.SetDefault("server.rabbitmq.connections", 1)
+	Connections.init(viper.GetInt("server.rabbitmq.connections"))
+
+	Options.InspectInterval = time.Duration(viper.GetInt("server.rabbitmq.inspect_interval")) * time.Second
+
+	// 先加载状态文件，创建 jobber 时重新应用手动的调整
+	if err := Intents.init(viper.GetString("state.path")); err != nil {
+		return err
+	}
 	if err := Jobbers.init(); err != nil {
 		return err
 	}
-	go Connection.run(ctx)
+
+	// 启动时记录当前的配置，第一次变化后也可以回滚
+	viper.SetDefault("history.max", 50)
+	if err := History.init(viper.GetString("history.path"), viper.GetInt("history.max")); err != nil {
+		return err
+	}
+	Connections.run(ctx)
+	go runInspector(ctx)
+
+	if viper.GetBool("watch.enable") {
+		viper.SetDefault("watch.debounce", 2)
+		debounce := time.Duration(viper.GetFloat64("watch.debounce") * float64(time.Second))
+		if err := watchInclude(ctx, debounce); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
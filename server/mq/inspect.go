@@ -0,0 +1,110 @@
+package mq
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// QueueInfo 队列的实时状态
+type QueueInfo struct {
+	Messages    int   // 队列中待消费的消息数
+	Unacked     int64 // 当前 jobber 已接收但尚未确认的消息数
+	Consumers   int   // 队列的消费者数量
+	Error       string
+	InspectTime time.Time
+}
+
+type queueInspector struct {
+	lock sync.RWMutex
+	info QueueInfo
+}
+
+// inspect 在独立的 channel 上被动声明队列，队列不存在时 channel 会被服务端关闭，不影响消费的 channel
+func (this *connection) inspect(queue string) (info QueueInfo, err error) {
+	channel, err := this.getChannel()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	q, err := channel.QueueInspect(queue)
+	if err != nil {
+		return
+	}
+
+	info.Messages = q.Messages
+	info.Consumers = q.Consumers
+	return
+}
+
+// refreshQueueInfo 查询并缓存队列状态
+func (this *Jobber) refreshQueueInfo() QueueInfo {
+	info, err := this.conn.inspect(this.GetQueueName())
+	if err != nil {
+		info.Error = err.Error()
+	}
+	info.Unacked = atomic.LoadInt64(&this.unacked)
+	info.InspectTime = time.Now()
+
+	this.inspector.lock.Lock()
+	this.inspector.info = info
+	this.inspector.lock.Unlock()
+
+	return info
+}
+
+// GetQueueInfo 获取队列状态，refresh 为 false 且开启了定时刷新时返回缓存的结果
+func (this *Jobber) GetQueueInfo(refresh bool) QueueInfo {
+	if refresh || Options.InspectInterval <= 0 {
+		return this.refreshQueueInfo()
+	}
+
+	this.inspector.lock.RLock()
+	info := this.inspector.info
+	this.inspector.lock.RUnlock()
+
+	info.Unacked = atomic.LoadInt64(&this.unacked)
+	return info
+}
+
+// cachedQueueInfo 获取定时刷新缓存的队列状态，没有开启定时刷新或者还没有刷新过时返回 false，不会查询 RabbitMQ
+func (this *Jobber) cachedQueueInfo() (QueueInfo, bool) {
+	if Options.InspectInterval <= 0 {
+		return QueueInfo{}, false
+	}
+
+	this.inspector.lock.RLock()
+	info := this.inspector.info
+	this.inspector.lock.RUnlock()
+
+	return info, !info.InspectTime.IsZero()
+}
+
+// runInspector 定时刷新所有 jobber 的队列状态
+func runInspector(ctx context.Context) {
+	interval := Options.InspectInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, jb := range Jobbers.List() {
+				info := jb.refreshQueueInfo()
+				if info.Error != "" {
+					logrus.Debugf("Inspect queue %s of jobber %s failed: %s", jb.GetQueueName(), jb.GetName(), info.Error)
+				}
+			}
+		}
+	}
+}
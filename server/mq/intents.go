@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Intent 手动的停止、暂停、调整线程数和限速，保存在状态文件中，
+// 服务重启后重新应用，reread 和 update 也不会覆盖，直到手动清除
+type Intent struct {
+	Stopped    bool      `json:"stopped,omitempty"`
+	Paused     bool      `json:"paused,omitempty"`
+	PauseUntil time.Time `json:"pause_until"`
+	WorkerNum  int       `json:"workernum,omitempty"`
+	RateLimit  *float64  `json:"ratelimit,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// empty 是否没有需要保持的操作
+func (this Intent) empty() bool {
+	return !this.Stopped && !this.Paused && this.WorkerNum <= 0 && this.RateLimit == nil
+}
+
+// Items 获取需要保持的操作的描述
+func (this Intent) Items() []string {
+	items := make([]string, 0)
+	if this.Stopped {
+		items = append(items, "stopped")
+	}
+	if this.Paused {
+		item := "paused"
+		if !this.PauseUntil.IsZero() {
+			item += " until " + this.PauseUntil.Format("2006-01-02 15:04:05")
+		}
+		items = append(items, item)
+	}
+	if this.WorkerNum > 0 {
+		items = append(items, "workernum="+strconv.Itoa(this.WorkerNum))
+	}
+	if this.RateLimit != nil {
+		items = append(items, "ratelimit="+strconv.FormatFloat(*this.RateLimit, 'f', -1, 64))
+	}
+	return items
+}
+
+// override 用手动调整的线程数和限速覆盖配置
+func (this Intent) override(options jobberOptions) jobberOptions {
+	if this.WorkerNum > 0 {
+		options.WorkerNum = this.WorkerNum
+	}
+	if this.RateLimit != nil {
+		options.RateLimit = *this.RateLimit
+	}
+	return options
+}
+
+type intentStore struct {
+	lock    sync.Mutex
+	path    string // 为空时只保存在内存中
+	intents map[string]Intent
+}
+
+// init 加载状态文件
+func (this *intentStore) init(path string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.path = path
+	this.intents = make(map[string]Intent)
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(b) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &this.intents); err != nil {
+		return errors.New(fmt.Sprintf("Load state file %s failed: %s", path, err.Error()))
+	}
+	return nil
+}
+
+// get 获取 jobber 需要保持的操作
+func (this *intentStore) get(name string) (Intent, bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	intent, found := this.intents[name]
+	return intent, found
+}
+
+// override 用 jobber 手动调整的线程数和限速覆盖配置
+func (this *intentStore) override(options jobberOptions) jobberOptions {
+	intent, _ := this.get(options.Name)
+	return intent.override(options)
+}
+
+// stopped 是否被手动停止
+func (this *intentStore) stopped(name string) bool {
+	intent, _ := this.get(name)
+	return intent.Stopped
+}
+
+// set 修改 jobber 需要保持的操作并写入状态文件，保存失败只记录日志
+func (this *intentStore) set(name string, fn func(intent *Intent)) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.intents == nil {
+		this.intents = make(map[string]Intent)
+	}
+
+	intent := this.intents[name]
+	fn(&intent)
+	if intent.empty() {
+		if _, found := this.intents[name]; !found {
+			return
+		}
+		delete(this.intents, name)
+	} else {
+		intent.Time = time.Now()
+		this.intents[name] = intent
+	}
+
+	if err := this.save(); err != nil {
+		logrus.Errorf("Save state file %s failed with error: %s", this.path, err.Error())
+	}
+}
+
+// clear 清除 jobber 需要保持的操作
+func (this *intentStore) clear(name string) {
+	this.set(name, func(intent *Intent) {
+		*intent = Intent{}
+	})
+}
+
+func (this *intentStore) save() error {
+	if this.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(this.intents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(this.path, b)
+}
+
+// GetIntent 获取 jobber 重启后仍然保持的手动操作
+func (this *Jobber) GetIntent() Intent {
+	intent, _ := Intents.get(this.name)
+	return intent
+}
+
+// Clear 清除 jobber 保持的手动操作，当前的运行状态不变，之后的启动和 reload 以配置文件为准
+func (this *jobberPools) Clear(name string) error {
+	if _, err := this.get(name); err != nil {
+		return err
+	}
+
+	Intents.clear(name)
+	return nil
+}
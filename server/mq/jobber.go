@@ -4,18 +4,22 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type jobberOptions struct {
-	Name  string
-	Queue struct {
+	Name    string
+	Group   string
+	Extends string
+	Queue   struct {
 		Name    string
 		Durable bool
 	}
@@ -24,17 +28,43 @@ type jobberOptions struct {
 		Etype   string `yaml:"type"`
 		Durable bool
 	}
-	BindKey   string `yaml:"bindkey"`
-	Consumer  string
-	WorkerNum int    `yaml:"workernum"`
-	TargetUrl string `yaml:"url"`
-	Log       struct {
+	BindKey      string `yaml:"bindkey"`
+	Consumer     string
+	ConsumerArgs struct {
+		Priority     int
+		SingleActive bool `yaml:"single_active_consumer"`
+		Exclusive    bool
+	} `yaml:"consumer_args"`
+	WorkerNum     int               `yaml:"workernum"`
+	PrefetchCount int               `yaml:"prefetch_count"`
+	PrefetchSize  int               `yaml:"prefetch_size"`
+	Channels      int               `yaml:"channels"`
+	TargetUrl     string            `yaml:"url"`
+	Headers       map[string]string `yaml:"headers"`
+	RateLimit     float64           `yaml:"ratelimit"`
+	Timeout       int               `yaml:"timeout"`
+	SlowThreshold int               `yaml:"slow_threshold"` // 慢请求的阈值，秒
+	Log           struct {
 		Path    string
 		Maxsize int
 	}
+	Autostart    *bool  `yaml:"autostart"`
+	Autorestart  string `yaml:"autorestart"`
+	StartRetries int    `yaml:"startretries"`
+	StartSecs    int    `yaml:"startsecs"`
+	Backoff      int    `yaml:"backoff"`
+	Autoscale    struct {
+		Enable        bool
+		Min           int
+		Max           int
+		TargetLatency int `yaml:"target_latency"` // 目标延迟，毫秒
+		Interval      int // 调整间隔，秒
+	} `yaml:"autoscale"`
 	configFile struct {
 		filePath     string
 		lastModified time.Time
+		hash         string         // 解析后配置的哈希，用于判断配置是否变化
+		raw          *jobberOptions // 没有替换引用的配置
 	}
 }
 
@@ -45,91 +75,152 @@ type jobberOptions struct {
  * lastModified 配置文件的最后修改日期
  */
 func NewJobber(options jobberOptions) (*Jobber, error) {
-	var err error
-	if options.Name == "" {
-		err = errors.New("Missing jobber's name")
+	if err := validateOptions(options); err != nil {
 		return nil, err
 	}
 
-	if options.Queue.Name == "" {
-		err = errors.New("Missing queue's name")
-		return nil, err
-	}
+	// 重新应用手动调整的线程数和限速，手动调整过线程数时不再自动调整
+	intent, _ := Intents.get(options.Name)
+	options = intent.override(options)
 
-	if options.Exchange.Name == "" {
-		err = errors.New("Missing exchange's name")
-		return nil, err
+	jb := &Jobber{
+		name:          options.Name,
+		options:       options,
+		stopTime:      time.Now(),
+		closeNotifies: make([]chan bool, 0),
+		state:         STOPPED,
+		logger:        NewLogger(options.Log.Path, options.Log.Maxsize),
+		limiter:       newRateLimiter(options.RateLimit),
 	}
+	jb.autoscaler.disabled = intent.WorkerNum > 0
+	return jb, nil
+}
 
-	if options.Exchange.Etype == "" {
-		err = errors.New("Missing exchange's type")
-		return nil, err
+// validateOptions 校验 jobber 的配置，返回第一个问题
+func validateOptions(options jobberOptions) error {
+	if issues := optionIssues(options); len(issues) > 0 {
+		return errors.New(issues[0].Message)
 	}
 
-	if options.Exchange.Etype != "direct" && options.Exchange.Etype != "fanout" {
-		err = errors.New("Exchange's type is not valid")
-		return nil, err
+	return nil
+}
+
+// prefetch 每个 channel 的预取数量，未配置时所有 channel 预取的总数与 workers 一致
+func (this jobberOptions) prefetch(workers int) int {
+	if this.PrefetchCount > 0 {
+		return this.PrefetchCount
 	}
 
-	if options.Log.Path == "" {
-		err = errors.New("Missing log path")
-		return nil, err
+	return (workers + this.Channels - 1) / this.Channels
+}
+
+// slowThreshold 慢请求的阈值，未配置时为超时时间的一半，也没有配置超时时间时为 10 秒
+func (this jobberOptions) slowThreshold() time.Duration {
+	if this.SlowThreshold > 0 {
+		return time.Duration(this.SlowThreshold) * time.Second
+	}
+	if this.Timeout > 0 {
+		return time.Duration(this.Timeout) * time.Second / 2
 	}
+	return 10 * time.Second
+}
 
-	return &Jobber{
-		name:          options.Name,
-		options:       options,
-		stopTime:      time.Now(),
-		closeNotifies: make([]chan bool, 0),
-		status:        0,
-		logger:        NewLogger(options.Log.Path, options.Log.Maxsize),
-	}, nil
+// autostart 未配置时默认自动启动
+func (this jobberOptions) autostart() bool {
+	return this.Autostart == nil || *this.Autostart
 }
 
 type Jobber struct {
 	name          string
-	channel       *amqp.Channel
+	conn          *connection
+	chLock        sync.Mutex
+	channels      []*amqp.Channel
+	consumerTags  []string
+	deliveries    chan amqp.Delivery
+	errs          chan error
+	lock          sync.RWMutex
 	options       jobberOptions
 	ctx           context.Context
 	cancle        context.CancelFunc
 	once          sync.Once
-	status        int32
+	stateLock     sync.Mutex
+	state         State
+	history       []Transition
+	supervising   bool
+	stopping      bool
+	superCancle   context.CancelFunc
 	closeNotifies []chan bool
 	startTime     time.Time
 	stopTime      time.Time
-	workers       chan int
+	workers       *workerPool
+	prefetch      int // channel 上当前生效的预取数量，由 chLock 保护
 	logger        *logger
+	limiter       *rateLimiter
+	unacked       int64
+	inspector     queueInspector
+	autoscaler    autoscaler
+	metrics       jobberMetrics
+	stats         jobberStats
+	cancels       int32
+	consumers     sync.WaitGroup // 正在转发消息的订阅
+	pauseUntil    time.Time
+	pauseTimer    *time.Timer
+	startPaused   bool // 手动暂停后重启，启动时不订阅，启动成功后恢复暂停
+	restoreUntil  time.Time
 }
 
-func (this *Jobber) preparStart() (msg <-chan amqp.Delivery, err error) {
-	ctx, cancle := context.WithCancel(context.Background())
+func (this *Jobber) preparStart(parent context.Context, options jobberOptions) (err error) {
+	ctx, cancle := context.WithCancel(parent)
 	this.ctx = ctx
 	this.cancle = cancle
+	prefetch := this.qosPrefetch(options)
+	this.chLock.Lock()
+	this.channels = make([]*amqp.Channel, 0, options.Channels)
+	this.consumerTags = make([]string, 0, options.Channels)
+	// 初始化工作线程池，运行中可以通过 scale 或自动调整改变大小
+	this.workers = newWorkerPool(this.autoscaler.reset(options))
+	this.prefetch = prefetch
+	this.startPaused, this.restoreUntil = this.pausedIntent()
+	startPaused := this.startPaused
+	this.chLock.Unlock()
+	this.clearPause()
+
+	defer func() {
+		if err != nil {
+			cancle()
+			this.closeChannels()
+		}
+	}()
 
-	// 获取一个 channel
-	this.channel, err = Connection.getChannel()
+	// 获取一个 channel，用于创建队列和路由
+	channel, err := this.conn.getChannel()
 	if err != nil {
 		return
 	}
+	this.addChannel(channel)
 
-	// 创建队列
-	_, err = this.channel.QueueDeclare(
-		this.options.Queue.Name,
-		this.options.Queue.Durable,
+	// 创建队列，single active consumer 需要在声明队列时指定，与已存在队列的参数不一致时会声明失败
+	var queueArgs amqp.Table
+	if options.ConsumerArgs.SingleActive {
+		queueArgs = amqp.Table{"x-single-active-consumer": true}
+	}
+	_, err = channel.QueueDeclare(
+		options.Queue.Name,
+		options.Queue.Durable,
 		false,
 		false,
 		false,
-		nil,
+		queueArgs,
 	)
 	if err != nil {
 		return
 	}
 
 	// 创建路由
-	err = this.channel.ExchangeDeclare(
-		this.options.Exchange.Name,
-		this.options.Exchange.Etype,
-		this.options.Exchange.Durable,
+	err = channel.ExchangeDeclare(
+		options.Exchange.Name,
+		options.Exchange.Etype,
+		options.Exchange.Durable,
 		false,
 		false,
 		false,
@@ -140,10 +231,10 @@ func (this *Jobber) preparStart() (msg <-chan amqp.Delivery, err error) {
 	}
 
 	// 绑定队列到路由
-	err = this.channel.QueueBind(
-		this.options.Queue.Name,
-		this.options.BindKey,
-		this.options.Exchange.Name,
+	err = channel.QueueBind(
+		options.Queue.Name,
+		options.BindKey,
+		options.Exchange.Name,
 		false,
 		nil,
 	)
@@ -151,91 +242,211 @@ func (this *Jobber) preparStart() (msg <-chan amqp.Delivery, err error) {
 		return
 	}
 
-	// 设置 QOS
-	err = this.channel.Qos(this.options.WorkerNum, 0, false)
-	if err != nil {
-		return
+	// 每个 channel 各自订阅队列，消息汇总到 deliveries 交给工作线程处理
+	// 每个 channel 的关闭通知和消息转发最多各上报一次错误
+	this.deliveries = make(chan amqp.Delivery)
+	this.errs = make(chan error, options.Channels*2)
+	for i := 0; i < options.Channels; i++ {
+		if i > 0 {
+			channel, err = this.conn.getChannel()
+			if err != nil {
+				return
+			}
+			this.addChannel(channel)
+		}
+
+		// 设置 QOS
+		err = channel.Qos(prefetch, options.PrefetchSize, false)
+		if err != nil {
+			return
+		}
+
+		go this.watchChannel(ctx, i, channel, this.errs)
+
+		// 订阅队列，需要恢复暂停时不订阅，恢复时使用同样的 consumer tag
+		tag := consumerTag(options.Consumer, this.name, i)
+		if !startPaused {
+			tag, err = this.subscribe(ctx, i, channel, options)
+			if err != nil {
+				return
+			}
+		}
+		this.chLock.Lock()
+		this.consumerTags = append(this.consumerTags, tag)
+		this.chLock.Unlock()
 	}
 
-	// 订阅队列
-	msg, err = this.channel.Consume(
-		this.options.Queue.Name,
-		this.options.Consumer,
-		false,
+	// 设置开始时间
+	this.startTime = time.Now()
+
+	return
+}
+
+// consumerTag 生成唯一的消费者标签，格式为 [prefix.]hostname.pid.jobber.channel
+func consumerTag(prefix string, name string, i int) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+
+	tag := fmt.Sprintf("%s.%d.%s.%d", hostname, os.Getpid(), name, i)
+	if prefix != "" {
+		tag = prefix + "." + tag
+	}
+	return tag
+}
+
+// subscribe 在 channel 上订阅队列，并把收到的消息转发给 jobber
+func (this *Jobber) subscribe(ctx context.Context, i int, channel *amqp.Channel, options jobberOptions) (string, error) {
+	var consumeArgs amqp.Table
+	if options.ConsumerArgs.Priority != 0 {
+		consumeArgs = amqp.Table{"x-priority": int32(options.ConsumerArgs.Priority)}
+	}
+
+	tag := consumerTag(options.Consumer, this.name, i)
+	msg, err := channel.Consume(
+		options.Queue.Name,
+		tag,
 		false,
+		options.ConsumerArgs.Exclusive,
 		false,
 		false,
-		nil,
+		consumeArgs,
 	)
+	if err != nil {
+		return "", err
+	}
+
+	this.consumers.Add(1)
+	go this.consume(ctx, i, atomic.LoadInt32(&this.cancels), msg, this.deliveries, this.errs)
+	return tag, nil
+}
+
+// watchChannel 监听 channel 关闭并上报错误，暂停时订阅已取消但 channel 仍然需要监听
+func (this *Jobber) watchChannel(ctx context.Context, i int, channel *amqp.Channel, errs chan<- error) {
+	closes := channel.NotifyClose(make(chan *amqp.Error, 1))
+	select {
+	case <-ctx.Done():
+	case err, ok := <-closes:
+		if ok && err != nil {
+			errs <- err
+		} else {
+			errs <- errors.New(fmt.Sprintf("channel #%d has closed", i))
+		}
+	}
+}
+
+// consume 将一个订阅上的消息转发给 jobber，订阅被意外关闭时上报错误
+// cancels 是订阅时主动取消订阅的次数，订阅之后次数变化说明订阅是被暂停或重新订阅取消的
+func (this *Jobber) consume(ctx context.Context, i int, cancels int32, msg <-chan amqp.Delivery, deliveries chan<- amqp.Delivery, errs chan<- error) {
+	defer this.consumers.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery, ok := <-msg:
+			if !ok {
+				// 主动取消订阅时，已预取的消息转发完后订阅关闭
+				if atomic.LoadInt32(&this.cancels) == cancels {
+					errs <- errors.New(fmt.Sprintf("delivery channel #%d has closed", i))
+				}
+				return
+			}
 
-	// 初始化工作线程池，线程池容量等于 mq.prefetchCount
-	this.workers = make(chan int, this.options.WorkerNum)
-	for i := 0; i < this.options.WorkerNum; i++ {
-		this.workers <- i
+			select {
+			case deliveries <- delivery:
+				atomic.AddInt64(&this.unacked, 1)
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
+}
 
-	// 初始化 jobber stop 的阻塞通知池
-	this.closeNotifies = make([]chan bool, 0)
+func (this *Jobber) addChannel(channel *amqp.Channel) {
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
 
-	// 设置状态和开始时间
-	atomic.StoreInt32(&this.status, 1)
-	this.startTime = time.Now()
+	this.channels = append(this.channels, channel)
+}
 
-	return
+// cancelConsumers 取消所有订阅(basic.cancel)，broker 不再投递新的消息，已投递的消息仍然可以确认，
+// 已预取的消息转发完后订阅关闭，不会被当作错误
+func (this *Jobber) cancelConsumers() {
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
+
+	atomic.AddInt32(&this.cancels, 1)
+	for i, tag := range this.consumerTags {
+		if i < len(this.channels) {
+			this.channels[i].Cancel(tag, false)
+		}
+	}
 }
 
-// Start 启动 Jobber
-func (this *Jobber) Start() {
+// closeChannels 关闭 jobber 打开的所有 channel
+func (this *Jobber) closeChannels() {
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
+
+	for _, channel := range this.channels {
+		channel.Close()
+	}
+	this.channels = nil
+	this.consumerTags = nil
+}
+
+// run 启动一次 jobber 并阻塞到退出，started 表示运行时间是否超过了 startsecs
+func (this *Jobber) run(parent context.Context, options jobberOptions) (started bool, runErr error) {
 	defer func() {
 		if err := recover(); err != nil {
 			switch err.(type) {
 			case error:
 				logrus.Errorln(err)
+				runErr = err.(error)
 			}
-		} else {
-			logrus.Infof("Jobber: %s exits", this.name)
 		}
 	}()
 
-	var (
-		msg <-chan amqp.Delivery
-		err error
-	)
-
-	if atomic.LoadInt32(&this.status) == 1 {
-		this.logger.Warnln("Jobber is always running,can't start again.")
+	if runErr = this.preparStart(parent, options); runErr != nil {
+		this.getLogger().Errorln(runErr)
 		return
 	}
+	go this.runAutoscaler(this.ctx)
 
-	if msg, err = this.preparStart(); err != nil {
-		this.logger.Errorln(err)
-		return
+	// 运行超过 startsecs 才认为启动成功
+	var startTimer <-chan time.Time
+	if options.StartSecs > 0 {
+		startTimer = time.After(time.Duration(options.StartSecs) * time.Second)
+	} else {
+		started = true
+		this.transit(RUNNING, "started")
+		this.getLogger().Infoln("Jobber started successful.")
+		this.restorePause()
 	}
 
-	this.logger.Infoln("Jobber started successful.")
-
-	notify := make(chan *amqp.Error)
-	var runErr error
 BREAK:
 	for {
 		select {
 		case <-this.ctx.Done():
 			break BREAK
-		case runErr = <-this.channel.NotifyClose(notify):
+		case runErr = <-this.errs:
 			break BREAK
-		case delivery, ok := <-msg:
-			if !ok {
-				runErr = errors.New("delivery channel has closed")
-				break BREAK
-			}
-
-			i, ok := <-this.workers
-			if !ok {
-				runErr = errors.New("workers channel has closed")
-				break BREAK
-			}
-
-			if atomic.LoadInt32(&this.status) != 1 {
+		case <-startTimer:
+			startTimer = nil
+			started = true
+			this.transit(RUNNING, "started")
+			this.getLogger().Infoln("Jobber started successful.")
+			this.restorePause()
+		case delivery := <-this.deliveries:
+			atomic.AddInt64(&this.metrics.received, 1)
+			i := this.workers.acquire()
+
+			// 限速，停止时还未处理的消息退回队列
+			if !this.limiter.wait(this.ctx) {
+				this.nack(delivery, true)
+				this.workers.release(i)
 				break BREAK
 			}
 
@@ -243,124 +454,210 @@ BREAK:
 		}
 	}
 
+	// 停止所有 channel 上的消息转发
+	this.cancle()
+
 	// 等待所有工作线程退出
-	for i := 0; i < this.options.WorkerNum; i++ {
-		<-this.workers
-	}
-	close(this.workers)
+	this.workers.wait()
 
-	// 根据运行中的错误情况判定，程序是正常退出还是异常退出
-	if runErr != nil {
-		atomic.StoreInt32(&this.status, -1)
-	} else {
-		atomic.StoreInt32(&this.status, 0)
-	}
 	this.stopTime = time.Now()
-
-	// 通知所有需要得知当前 Jobber 退出情况的监听者
-	if len(this.closeNotifies) > 0 {
-		for _, c := range this.closeNotifies {
-			close(c)
-		}
-	}
-
 	if runErr != nil {
-		this.logger.Errorln("Jobber exits with error: ", runErr.Error())
+		this.getLogger().Errorln("Jobber exits with error: ", runErr.Error())
 	} else {
-		this.logger.Infoln("Jobber exits.")
+		this.getLogger().Infoln("Jobber exits.")
 	}
-	this.channel.Close()
+	this.closeChannels()
+	this.clearPause()
+
+	return
 }
 
 func (this *Jobber) do(msg amqp.Delivery, i int) {
+	options := this.getOptions()
+	logger := this.getLogger()
+
+	// 停止时等待请求完成，不跟随 jobber 的 context 取消，只能通过 CancelWorker 手动取消
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	this.workers.begin(i, &workerTask{
+		deliveryTag: msg.DeliveryTag,
+		messageId:   msg.MessageId,
+		body:        msg.Body,
+		target:      options.redacted().TargetUrl,
+		start:       time.Now(),
+		cancel:      cancel,
+	})
+
 	defer func() {
 		if err := recover(); err != nil {
 			switch err.(type) {
 			case error:
-				this.logger.With("workerId", i).Errorln("Jobber do request has some error: ", err.(error).Error())
+				logger.With("workerId", i).Errorln("Jobber do request has some error: ", err.(error).Error())
 			}
 		}
 
-		msg.Ack(false)
-		this.workers <- i
+		this.ack(msg)
+		this.workers.release(i)
 		//this.logger.With("workerId",i).Info("Do request end")
 	}()
 
 	post := func(postData []byte, u string) ([]byte, int, error) {
 		httpCode := 0
-		client := &http.Client{}
+		client := &http.Client{
+			Timeout: time.Duration(options.Timeout) * time.Second,
+		}
 		rawData := bytes.NewBuffer(postData)
 		req, err := http.NewRequest("POST", u, rawData)
 		if err != nil {
 			return []byte(""), httpCode, err
 		}
+		req = req.WithContext(ctx)
 		req.Header.Set("Content-type", "application/json")
+		for k, v := range options.Headers {
+			req.Header.Set(k, v)
+		}
 
 		response, err := client.Do(req)
 		if err != nil {
 			return []byte(""), httpCode, err
 		}
+		defer response.Body.Close()
 
-		this.logger.Warnln("do request")
+		logger.Warnln("do request")
 		if response.StatusCode != 200 {
 			httpCode = response.StatusCode
 			return []byte(""), httpCode, nil
 		}
-		defer response.Body.Close()
 
 		body, _ := ioutil.ReadAll(response.Body)
 
 		return body, response.StatusCode, nil
 	}
 
-	rsp, httpcode, err := post(msg.Body, this.options.TargetUrl)
+	start := time.Now()
+	rsp, httpcode, err := post(msg.Body, options.TargetUrl)
+	elapsed := time.Since(start)
+	this.autoscaler.observe(elapsed, err != nil || httpcode >= 500)
+	this.metrics.observe(elapsed, httpcode, err)
+
+	// 请求失败和非 200 的响应都算作失败
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	} else if httpcode != http.StatusOK {
+		errMsg = fmt.Sprintf("http status %d", httpcode)
+	}
+	this.stats.record(elapsed, errMsg)
+
+	if elapsed > options.slowThreshold() {
+		logger.WithFields(map[string]interface{}{
+			"workerId": i,
+			"elapsed":  elapsed.String(),
+			"canceled": this.workers.canceled(i),
+			"url":      options.TargetUrl,
+		}).Warnln("slow request")
+	}
 
 	if err != nil {
-		this.logger.WithFields(map[string]interface{}{
+		logger.WithFields(map[string]interface{}{
 			"delivery":  string(msg.Body[:]),
 			"http_code": httpcode,
 			"workerId":  i,
 			"response":  string(rsp[:]),
-			"url":       this.options.TargetUrl,
+			"url":       options.TargetUrl,
 		}).Warnln("end request")
 	} else {
-		this.logger.WithFields(map[string]interface{}{
+		logger.WithFields(map[string]interface{}{
 			"delivery":  string(msg.Body[:]),
 			"http_code": httpcode,
 			"workerId":  i,
 			"response":  string(rsp[:]),
-			"url":       this.options.TargetUrl,
+			"url":       options.TargetUrl,
 		}).Infoln("end request")
 	}
 }
 
 // Stop 停止，并阻塞等待停止完成
 func (this *Jobber) Stop(c chan bool) chan bool {
-	s := atomic.LoadInt32(&this.status)
-	if s != 1 {
+	this.lock.Lock()
+	if !this.supervising {
+		this.lock.Unlock()
 		close(c)
-	} else {
-		this.closeNotifies = append(this.closeNotifies, c)
-		this.cancle()
+		return c
 	}
 
+	this.stopping = true
+	this.transit(STOPPING, "stop")
+	this.closeNotifies = append(this.closeNotifies, c)
+	cancle := this.superCancle
+	this.lock.Unlock()
+
+	cancle()
 	return c
 }
 
-// GetStatus 获取当前状态
-func (this *Jobber) GetStatus() (int32, string) {
-	s := atomic.LoadInt32(&this.status)
-	var str string
-	switch s {
-	case 0:
-		str = "STOPPED"
-	case 1:
-		str = "RUNNING"
-	case -1:
-		str = "FATAL"
+// Shutdown 先取消订阅，等待已预取的消息和正在处理的请求完成后再停止，
+// 超时后关闭 channel 让 broker 重新投递未确认的消息，并取消正在处理的请求，返回时 jobber 已经完全停止
+func (this *Jobber) Shutdown(timeout time.Duration) error {
+	this.cancelConsumers()
+
+	drained := make(chan struct{})
+	go func() {
+		this.drain()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		this.closeChannels()
+		this.cancelWorkers()
+		this.getLogger().Warnf("Jobber drain timeout after %s, unacked deliveries will be requeued", timeout)
+		err = errors.New(fmt.Sprintf("Jobber %s drain timeout", this.name))
+	}
+
+	<-this.Stop(make(chan bool))
+	return err
+}
+
+// drain 等待所有订阅转发完已预取的消息，并且所有消息都已经确认
+func (this *Jobber) drain() {
+	this.consumers.Wait()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&this.unacked) > 0 {
+		<-ticker.C
 	}
+}
+
+// cancelWorkers 取消所有正在处理的请求
+func (this *Jobber) cancelWorkers() {
+	this.chLock.Lock()
+	workers := this.workers
+	this.chLock.Unlock()
+
+	if workers == nil {
+		return
+	}
+	for _, info := range workers.list(0) {
+		workers.cancel(info.Id)
+	}
+}
+
+// GetStatus 获取当前状态
+func (this *Jobber) GetStatus() (State, string) {
+	s := this.GetState()
+	return s, s.String()
+}
 
-	return s, str
+// IsActive 是否处于守护中，包括启动中、运行中和等待重启
+func (this *Jobber) IsActive() bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.supervising
 }
 
 // GetName 获取当前 Jobber.Name
@@ -368,21 +665,60 @@ func (this *Jobber) GetName() string {
 	return this.name
 }
 
+// GetGroup 获取所属的分组
+func (this *Jobber) GetGroup() string {
+	return this.getOptions().Group
+}
+
 // GetQueueName 获取监听的队列名称
 func (this *Jobber) GetQueueName() string {
-	return this.options.Queue.Name
-}
-
-// GetWorkers 获取所有的 workers
-//func (this *Jobber) GetWorkers() []*worker {
-//	wks := make([]*worker, 0)
-//	vals := this.workers.Values()
-//	for _, v := range vals {
-//		wks = append(wks, v.(*worker))
-//	}
-//
-//	return wks
-//}
+	return this.getOptions().Queue.Name
+}
+
+// getOptions 获取当前配置的拷贝
+func (this *Jobber) getOptions() jobberOptions {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.options
+}
+
+// getLogger 获取当前的日志
+func (this *Jobber) getLogger() *logger {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.logger
+}
+
+// GetWorkers 获取正在处理请求的工作线程，没有运行时为空
+func (this *Jobber) GetWorkers() []WorkerInfo {
+	this.chLock.Lock()
+	workers := this.workers
+	this.chLock.Unlock()
+
+	if workers == nil {
+		return []WorkerInfo{}
+	}
+	return workers.list(this.getOptions().slowThreshold())
+}
+
+// CancelWorker 取消工作线程正在处理的请求，消息按请求失败处理
+func (this *Jobber) CancelWorker(id int) error {
+	this.chLock.Lock()
+	workers := this.workers
+	this.chLock.Unlock()
+
+	if workers == nil {
+		return errors.New(fmt.Sprintf("Worker %d is idle", id))
+	}
+	if err := workers.cancel(id); err != nil {
+		return err
+	}
+
+	this.getLogger().With("workerId", id).Warnln("Request canceled manually.")
+	return nil
+}
 
 // GetStartTime 获取开始日期
 func (this *Jobber) GetStartTime() time.Time {
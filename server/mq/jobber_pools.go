@@ -3,23 +3,24 @@ package mq
 import (
 	"errors"
 	"fmt"
-	"github.com/emirpasic/gods/maps/hashmap"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
 	"os"
-	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 )
 
 type jobberPools struct {
-	jobbers *hashmap.Map // 正在运行中的 jobber
-	changed *hashmap.Map
+	jobbers map[string]*Jobber // 正在运行中的 jobber
+	rwLock  sync.RWMutex       // 保护 jobbers，连接守护和 api 会并发访问
+	changed map[string]jobberOptions
 	removed []string
+	lock    sync.Mutex // 保证 reread 和 update 不会并发执行
 }
 
 func (this *jobberPools) init() error {
-	ops, err := this.read()
+	ops, _, err := this.read()
 	if err != nil {
 		return err
 	}
@@ -29,35 +30,73 @@ func (this *jobberPools) init() error {
 		if err != nil {
 			return err
 		}
-		this.jobbers.Put(o.Name, jb)
+		this.put(jb)
 	}
 
 	return nil
 }
 
-func (this *jobberPools) read() (ops map[string]jobberOptions, err error) {
-	includePath := viper.GetString("include")
-	if includePath == "" {
-		err = errors.New("Jobber config path is empty.")
+// put 为 jobber 分配连接后加入池中
+func (this *jobberPools) put(jb *Jobber) {
+	jb.conn = Connections.assign()
+
+	this.rwLock.Lock()
+	defer this.rwLock.Unlock()
+	this.jobbers[jb.name] = jb
+}
+
+// get 按名称获取 jobber
+func (this *jobberPools) get(name string) (*Jobber, error) {
+	this.rwLock.RLock()
+	defer this.rwLock.RUnlock()
+
+	jb, found := this.jobbers[name]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("Not found jobber %s", name))
+	}
+	return jb, nil
+}
+
+// names 获取所有 jobber 的名称，按名称排序
+func (this *jobberPools) names() []string {
+	this.rwLock.RLock()
+	defer this.rwLock.RUnlock()
+
+	names := make([]string, 0, len(this.jobbers))
+	for name := range this.jobbers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// read 读取所有 jobber 配置文件，解析或校验失败的文件记录在 invalids 中，不会被应用
+func (this *jobberPools) read() (ops map[string]jobberOptions, invalids map[string]string, err error) {
+	match, err := includeFiles()
+	if err != nil {
 		return
 	}
 
-	match, err := filepath.Glob(includePath)
+	// jobber.yaml 中 jobbers 列表里的 jobber 和配置文件一起加载，名称重复时报错
+	inline, err := inlineJobbers()
 	if err != nil {
 		return
 	}
 
 	ops = make(map[string]jobberOptions)
-	for _, v := range match {
-		op, err := this.parseConfig(v)
-		if err != nil {
-			logrus.Errorf("Parse config: %s failed with error: %s", v, err.Error())
+	invalids = make(map[string]string)
+	for _, report := range validateFiles(match, inline) {
+		if !report.Valid() {
+			logrus.Errorf("Parse config: %s failed with error: %s", report.File, report.Error())
+			invalids[report.File] = report.Error()
 			continue
 		}
 
-		fileInfo, _ := os.Stat(v)
-		op.configFile.filePath = v
-		op.configFile.lastModified = fileInfo.ModTime()
+		op := report.options
+		op.configFile.filePath = report.File
+		if fileInfo, err := os.Stat(report.File); err == nil {
+			op.configFile.lastModified = fileInfo.ModTime()
+		}
 
 		ops[op.Name] = op
 	}
@@ -65,33 +104,32 @@ func (this *jobberPools) read() (ops map[string]jobberOptions, err error) {
 	return
 }
 
-func (this *jobberPools) parseConfig(fileName string) (options jobberOptions, err error) {
-	var b []byte
-	b, err = ioutil.ReadFile(fileName)
-	if err != nil {
-		return
-	}
-
-	err = yaml.Unmarshal(b, &options)
-	if err != nil {
-		return
+// Start 手动启动 jobber，清除保持的停止和暂停
+func (this *jobberPools) Start(name string) error {
+	if err := this.start(name); err != nil {
+		return err
 	}
 
-	return options, err
+	Intents.set(name, func(intent *Intent) {
+		intent.Stopped = false
+		intent.Paused = false
+		intent.PauseUntil = time.Time{}
+	})
+	return nil
 }
 
-func (this *jobberPools) Start(name string) error {
-	var jb *Jobber
-
-	temp, found := this.jobbers.Get(name)
-	if !found {
-		return errors.New(fmt.Sprintf("Not found jobber %s", name))
+// start 启动 jobber，不改变保持的手动操作，用于自动启动
+func (this *jobberPools) start(name string) error {
+	if IsShuttingDown() {
+		return errors.New("Server is shutting down.")
 	}
 
-	jb = temp.(*Jobber)
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
 
-	status, _ := jb.GetStatus()
-	if status == 1 {
+	if jb.IsActive() {
 		return errors.New(fmt.Sprintf("Jobber %s has started.", name))
 	}
 
@@ -99,16 +137,21 @@ func (this *jobberPools) Start(name string) error {
 	return nil
 }
 
+// Stop 手动停止 jobber，服务重启后保持停止，直到手动启动或者清除
 func (this *jobberPools) Stop(name string) error {
-	temp, found := this.jobbers.Get(name)
-	if !found {
-		return errors.New(fmt.Sprintf("Not found jobber %s", name))
+	jb, err := this.get(name)
+	if err != nil {
+		return err
 	}
 
 	c := make(chan bool)
-	jb := temp.(*Jobber)
 	<-jb.Stop(c)
 
+	Intents.set(name, func(intent *Intent) {
+		intent.Stopped = true
+		intent.Paused = false
+		intent.PauseUntil = time.Time{}
+	})
 	return nil
 }
 
@@ -120,14 +163,49 @@ func (this *jobberPools) Restart(name string) error {
 	return this.Start(name)
 }
 
-func (this *jobberPools) Reload(name string) {
+// Reload 重新读取一个 jobber 的配置文件并应用
+func (this *jobberPools) Reload(name string, source string) (result UpdateResult, err error) {
+	jb, err := this.get(name)
+	if err != nil {
+		return
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if err = viper.ReadInConfig(); err != nil {
+		return
+	}
+
+	ops, invalids, err := this.read()
+	if err != nil {
+		return
+	}
+
+	if e, found := invalids[jb.getOptions().configFile.filePath]; found {
+		err = errors.New(fmt.Sprintf("Config of jobber %s is invalid: %s", name, e))
+		return
+	}
 
+	op, found := ops[name]
+	if !found {
+		err = errors.New(fmt.Sprintf("Not found config of jobber %s", name))
+		return
+	}
+	op = Intents.override(op)
+
+	diffs := map[string][]FieldDiff{name: diffFields(jb.getOptions(), op)}
+	result = jb.update(op)
+	delete(this.changed, name)
+
+	if changes := versionChanges([]UpdateResult{result}, diffs); len(changes) > 0 {
+		History.add(source, 0, changes)
+	}
+	return
 }
 
 func (this *jobberPools) StartAll() error {
-	vals := this.jobbers.Keys()
-	for _, v := range vals {
-		name := v.(string)
+	for _, name := range this.names() {
 		this.Start(name)
 	}
 
@@ -135,49 +213,79 @@ func (this *jobberPools) StartAll() error {
 }
 
 func (this *jobberPools) StopAll() error {
-	temp := this.jobbers.Values()
-	for _, v := range temp {
-		j := v.(*Jobber)
+	for _, jb := range this.List() {
 		c := make(chan bool)
-		<-j.Stop(c)
+		<-jb.Stop(c)
 	}
 	return nil
 }
 
 func (this *jobberPools) RestartAll() error {
-	keys := this.jobbers.Keys()
-	for _, v := range keys {
-		name := v.(string)
+	for _, name := range this.names() {
 		this.Restart(name)
 	}
 	return nil
 }
 
+// List 获取所有 jobber，按名称排序
 func (this *jobberPools) List() []*Jobber {
-	jbs := make([]*Jobber, 0)
-	vals := this.jobbers.Values()
-	for _, val := range vals {
-		jbs = append(jbs, val.(*Jobber))
+	names := this.names()
+
+	this.rwLock.RLock()
+	defer this.rwLock.RUnlock()
+
+	jbs := make([]*Jobber, 0, len(names))
+	for _, name := range names {
+		if jb, found := this.jobbers[name]; found {
+			jbs = append(jbs, jb)
+		}
 	}
 	return jbs
 }
 
+// History 获取 jobber 的状态转换历史
+func (this *jobberPools) History(name string) ([]Transition, error) {
+	jb, err := this.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return jb.GetHistory(), nil
+}
+
 func (this *jobberPools) Remove(name string) error {
-	temp, found := this.jobbers.Get(name)
-	if !found {
-		return errors.New(fmt.Sprintf("Not found jobber %s", name))
+	jb, err := this.get(name)
+	if err != nil {
+		return err
 	}
 
-	jb := temp.(*Jobber)
 	c := make(chan bool)
 	<-jb.Stop(c)
-	this.jobbers.Remove(name)
+
+	this.rwLock.Lock()
+	delete(this.jobbers, name)
+	this.rwLock.Unlock()
+
+	Connections.release(jb.conn)
 	return nil
 }
 
-func (this *jobberPools) Reread() (changeNames []string, removes []string, err error) {
+// Reread 重新读取配置，对比得到变化和删除的 jobber，配置文件无效的 jobber 保持不变
+func (this *jobberPools) Reread() (changeNames []string, removes []string, invalids map[string]string, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.reread()
+}
+
+// reread 调用方需要持有 this.lock
+func (this *jobberPools) reread() (changeNames []string, removes []string, invalids map[string]string, err error) {
+	// 重新读取 jobber.yaml，defaults 和模板的修改对继承的 jobber 生效
+	if err = viper.ReadInConfig(); err != nil {
+		return
+	}
+
 	var ops map[string]jobberOptions
-	ops, err = this.read()
+	ops, invalids, err = this.read()
 	if err != nil {
 		return
 	}
@@ -185,65 +293,139 @@ func (this *jobberPools) Reread() (changeNames []string, removes []string, err e
 	changeNames = make([]string, 0)
 	removes = make([]string, 0)
 
-	this.changed.Clear()
+	this.changed = make(map[string]jobberOptions)
 	this.removed = []string{}
 
 	for _, op := range ops {
-		temp, found := this.jobbers.Get(op.Name)
-		if !found {
-			this.changed.Put(op.Name, op)
+		jb, err := this.get(op.Name)
+		if err != nil {
+			this.changed[op.Name] = op
 			continue
 		}
 
-		jb := temp.(*Jobber)
-		if op.configFile.lastModified.Unix() > jb.options.configFile.lastModified.Unix() {
-			this.changed.Put(op.Name, op)
+		// 比较解析后配置的哈希，只修改时间变化不算，继承的 defaults、模板以及引用的环境变量变化也能发现
+		if op.configFile.hash != jb.getOptions().configFile.hash {
+			this.changed[op.Name] = op
 		}
 	}
 
-	keys := this.jobbers.Keys()
-	for _, v := range keys {
-		name := v.(string)
-		if _, found := ops[name]; !found {
-			this.removed = append(this.removed, name)
+	for _, jb := range this.List() {
+		if _, found := ops[jb.name]; found {
+			continue
+		}
+
+		if _, invalid := invalids[jb.getOptions().configFile.filePath]; invalid {
+			continue
 		}
+		this.removed = append(this.removed, jb.name)
 	}
 
-	temp := this.changed.Keys()
-	for _, v := range temp {
-		changeNames = append(changeNames, v.(string))
+	for name := range this.changed {
+		changeNames = append(changeNames, name)
 	}
+	sort.Strings(changeNames)
 
 	removes = this.removed
 
 	return
 }
 
-func (this *jobberPools) Update() error {
-	for _, v := range this.removed {
-		this.Remove(v)
+// Update 应用 Reread 得到的变化，返回每个 jobber 的更新结果，有变化时记录一个配置版本
+func (this *jobberPools) Update(source string) []UpdateResult {
+	return this.update(source, 0)
+}
+
+func (this *jobberPools) update(source string, rollback int64) []UpdateResult {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.updateAll(source, rollback)
+}
+
+// updateAll 应用所有待更新的变化，调用方需要持有 this.lock
+func (this *jobberPools) updateAll(source string, rollback int64) []UpdateResult {
+	results := this.applyChanges(this.changed, this.removed, source, rollback)
+	this.changed = make(map[string]jobberOptions)
+	this.removed = []string{}
+	return results
+}
+
+// applyChanges 移除、新建或更新 jobber，有变化时记录一个配置版本，调用方需要持有 this.lock
+func (this *jobberPools) applyChanges(changed map[string]jobberOptions, removed []string, source string, rollback int64) []UpdateResult {
+	results := make([]UpdateResult, 0)
+	diffs := make(map[string][]FieldDiff)
+
+	for _, v := range removed {
+		result := UpdateResult{
+			Name:   v,
+			Action: UPDATE_REMOVED,
+		}
+		if err := this.Remove(v); err != nil {
+			result.Action = UPDATE_FAILED
+			result.Error = err.Error()
+		} else {
+			// 配置已经删除，不再保持手动操作
+			Intents.clear(v)
+		}
+		results = append(results, result)
 	}
 
-	keys := this.changed.Keys()
-	for _, k := range keys {
-		name := k.(string)
-		temp, found := this.jobbers.Get(name)
-		if !found {
-			temp, _ = this.changed.Get(name)
-			op := temp.(jobberOptions)
+	names := make([]string, 0, len(changed))
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// 手动调整的线程数和限速不会被配置覆盖
+		op := Intents.override(changed[name])
+
+		jb, err := this.get(name)
+		if err != nil {
+			result := UpdateResult{
+				Name:   name,
+				Action: UPDATE_ADDED,
+			}
+
 			jb, err := NewJobber(op)
 			if err != nil {
 				logrus.Warnln("Jobber update failed,error: ", err)
+				result.Action = UPDATE_FAILED
+				result.Error = err.Error()
+				results = append(results, result)
 				continue
 			}
-			this.jobbers.Put(name, jb)
-			this.Start(name)
+			this.put(jb)
+			if op.autostart() {
+				this.start(name)
+			}
+			results = append(results, result)
 		} else {
-			jb := temp.(*Jobber)
-			temp, _ := this.changed.Get(name)
-			op := temp.(jobberOptions)
-			jb.options = op
+			diffs[name] = diffFields(jb.getOptions(), op)
+			results = append(results, jb.update(op))
 		}
 	}
-	return nil
+
+	if changes := versionChanges(results, diffs); len(changes) > 0 {
+		History.add(source, rollback, changes)
+	}
+
+	return results
+}
+
+// versionChanges 从更新结果中获取应用了的变化，没有变化和更新失败的 jobber 不记录
+func versionChanges(results []UpdateResult, diffs map[string][]FieldDiff) []VersionChange {
+	changes := make([]VersionChange, 0)
+	for _, r := range results {
+		if r.Action == UPDATE_UNCHANGED || r.Action == UPDATE_FAILED {
+			continue
+		}
+		changes = append(changes, VersionChange{
+			Name:   r.Name,
+			Action: r.Action,
+			Diffs:  diffs[r.Name],
+			Error:  r.Error,
+		})
+	}
+	return changes
 }
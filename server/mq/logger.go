@@ -5,6 +5,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
 	"runtime"
 	"strings"
 	"time"
@@ -25,12 +26,13 @@ func NewLogger(logpath string, maxSize int) *logger {
 	encodeConfig.TimeKey = "time"
 	encodeConfig.EncodeTime = timeEncoder
 
-	w := zapcore.AddSync(&lumberjack.Logger{
+	writer := &lumberjack.Logger{
 		Filename:   logpath,
 		MaxSize:    maxSize, // megabytes
 		MaxBackups: 30,
 		MaxAge:     10, // days
-	})
+	}
+	w := zapcore.AddSync(writer)
 
 	level := zap.NewAtomicLevelAt(zap.DebugLevel)
 
@@ -40,11 +42,21 @@ func NewLogger(logpath string, maxSize int) *logger {
 		level,
 	)
 
-	return &logger{zap.New(core)}
+	return &logger{zap.New(core), writer}
 }
 
 type logger struct {
-	_log *zap.Logger
+	_log   *zap.Logger
+	writer io.Closer
+}
+
+// Close 关闭日志文件
+func (l *logger) Close() error {
+	l._log.Sync()
+	if l.writer == nil {
+		return nil
+	}
+	return l.writer.Close()
 }
 
 // Print logs a message at level Info on the compatibleLogger.
@@ -63,7 +75,7 @@ func (l *logger) Printf(format string, args ...interface{}) {
 }
 
 func (l *logger) With(key string, value interface{}) *logger {
-	return &logger{l._log.With(zap.Any(key, value))}
+	return &logger{l._log.With(zap.Any(key, value)), l.writer}
 }
 
 func (l *logger) WithFields(fields map[string]interface{}) *logger {
@@ -0,0 +1,91 @@
+package mq
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ControlResult 批量操作中一个 jobber 的结果
+type ControlResult struct {
+	Name  string
+	Error string
+}
+
+// matchOne 判断 jobber 是否匹配，支持 all、<group>:*、<group>:<name> 以及通配符
+func matchOne(pattern string, jb *Jobber) bool {
+	if pattern == "all" {
+		return true
+	}
+
+	name := pattern
+	if i := strings.Index(pattern, ":"); i >= 0 {
+		if pattern[:i] != jb.GetGroup() {
+			return false
+		}
+		name = pattern[i+1:]
+	}
+
+	ok, err := filepath.Match(name, jb.name)
+	return err == nil && ok
+}
+
+// Match 匹配 jobber 名称，返回按名称排序、去重后的结果，以及没有匹配到任何 jobber 的模式
+func (this *jobberPools) Match(patterns ...string) (names []string, unmatched []string) {
+	jbs := this.List()
+	names = make([]string, 0)
+	unmatched = make([]string, 0)
+	matched := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		found := false
+		for _, jb := range jbs {
+			if !matchOne(pattern, jb) {
+				continue
+			}
+
+			found = true
+			matched[jb.name] = true
+		}
+
+		if !found {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+
+	for _, jb := range jbs {
+		if matched[jb.name] {
+			names = append(names, jb.name)
+		}
+	}
+	return
+}
+
+// Each 对匹配到的每个 jobber 并发执行 fn，每个 jobber 一个结果，某个失败不影响其它 jobber
+func (this *jobberPools) Each(patterns []string, fn func(name string) error) []ControlResult {
+	names, unmatched := this.Match(patterns...)
+
+	results := make([]ControlResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			results[i].Name = name
+			if err := fn(name); err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, name)
+	}
+	wg.Wait()
+
+	for _, pattern := range unmatched {
+		results = append(results, ControlResult{
+			Name:  pattern,
+			Error: fmt.Sprintf("Not found jobber %s", pattern),
+		})
+	}
+	return results
+}
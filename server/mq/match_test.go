@@ -0,0 +1,64 @@
+package mq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchOne(t *testing.T) {
+	jb := &Jobber{name: "goldbean", options: jobberOptions{Name: "goldbean", Group: "marketing"}}
+
+	cases := []struct {
+		pattern string
+		ok      bool
+	}{
+		{"all", true},
+		{"goldbean", true},
+		{"gold", false},
+		{"gold*", true},
+		{"*bean", true},
+		{"g?ldbean", true},
+		{"[fg]oldbean", true},
+		{"silver*", false},
+		{"marketing:*", true},
+		{"marketing:goldbean", true},
+		{"marketing:gold*", true},
+		{"marketing:silver", false},
+		{"order:*", false},
+		{"order:goldbean", false},
+		{":goldbean", false},
+		{"[", false},
+	}
+
+	for _, c := range cases {
+		if ok := matchOne(c.pattern, jb); ok != c.ok {
+			t.Errorf("matchOne(%q) = %t, want %t", c.pattern, ok, c.ok)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	pools := &jobberPools{jobbers: make(map[string]*Jobber)}
+	for name, group := range map[string]string{"goldbean": "marketing", "haoapple": "marketing", "order": "order"} {
+		pools.jobbers[name] = &Jobber{name: name, options: jobberOptions{Name: name, Group: group}}
+	}
+
+	cases := []struct {
+		patterns  []string
+		names     []string
+		unmatched []string
+	}{
+		{[]string{"all"}, []string{"goldbean", "haoapple", "order"}, []string{}},
+		{[]string{"marketing:*"}, []string{"goldbean", "haoapple"}, []string{}},
+		{[]string{"order", "goldbean", "order"}, []string{"goldbean", "order"}, []string{}},
+		{[]string{"*a*", "missing"}, []string{"goldbean", "haoapple"}, []string{"missing"}},
+		{[]string{"order:goldbean"}, []string{}, []string{"order:goldbean"}},
+	}
+
+	for _, c := range cases {
+		names, unmatched := pools.Match(c.patterns...)
+		if !reflect.DeepEqual(names, c.names) || !reflect.DeepEqual(unmatched, c.unmatched) {
+			t.Errorf("Match(%v) = %v %v, want %v %v", c.patterns, names, unmatched, c.names, c.unmatched)
+		}
+	}
+}
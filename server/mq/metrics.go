@@ -0,0 +1,238 @@
+package mq
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// latencyBuckets 请求延迟直方图的上限，秒
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// jobberMetrics jobber 的累计统计，jobber 重启后不清零
+type jobberMetrics struct {
+	received     int64
+	acked        int64
+	nacked       int64
+	requeued     int64
+	deadLettered int64
+
+	lock    sync.Mutex
+	codes   map[string]int64 // 后端返回的状态码，请求失败时为 error
+	buckets []int64
+	sum     float64
+	count   int64
+}
+
+// observe 记录一次请求的延迟和状态码
+func (this *jobberMetrics) observe(d time.Duration, code int, err error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.codes == nil {
+		this.codes = make(map[string]int64)
+		this.buckets = make([]int64, len(latencyBuckets))
+	}
+
+	if err != nil {
+		this.codes["error"]++
+	} else {
+		this.codes[strconv.Itoa(code)]++
+	}
+
+	seconds := d.Seconds()
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			this.buckets[i]++
+		}
+	}
+	this.sum += seconds
+	this.count++
+}
+
+// ack 确认消息
+func (this *Jobber) ack(msg amqp.Delivery) {
+	if err := msg.Ack(false); err == nil {
+		atomic.AddInt64(&this.metrics.acked, 1)
+	}
+	atomic.AddInt64(&this.unacked, -1)
+}
+
+// nack 拒绝消息，requeue 为 false 时配置了死信路由的队列会转发到死信路由
+func (this *Jobber) nack(msg amqp.Delivery, requeue bool) {
+	if err := msg.Nack(false, requeue); err == nil {
+		atomic.AddInt64(&this.metrics.nacked, 1)
+		if requeue {
+			atomic.AddInt64(&this.metrics.requeued, 1)
+		} else {
+			atomic.AddInt64(&this.metrics.deadLettered, 1)
+		}
+	}
+	atomic.AddInt64(&this.unacked, -1)
+}
+
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (this *metricsWriter) header(name, mtype, help string) {
+	fmt.Fprintf(&this.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, mtype)
+}
+
+// sample 写入一个样本，labels 为成对的名称和值
+func (this *metricsWriter) sample(name string, value float64, labels ...string) {
+	this.buf.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+		}
+		this.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	this.buf.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+func escapeLabel(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+// Metrics 以 Prometheus 文本格式输出 jobber、连接和队列的指标
+func Metrics() []byte {
+	w := new(metricsWriter)
+	jbs := Jobbers.List()
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(m *jobberMetrics) *int64
+	}{
+		{"jobber_deliveries_received_total", "Deliveries received from the queue.", func(m *jobberMetrics) *int64 { return &m.received }},
+		{"jobber_deliveries_acked_total", "Deliveries acknowledged.", func(m *jobberMetrics) *int64 { return &m.acked }},
+		{"jobber_deliveries_nacked_total", "Deliveries negatively acknowledged.", func(m *jobberMetrics) *int64 { return &m.nacked }},
+		{"jobber_deliveries_requeued_total", "Deliveries nacked and requeued.", func(m *jobberMetrics) *int64 { return &m.requeued }},
+		{"jobber_deliveries_dead_lettered_total", "Deliveries nacked without requeue, routed to the dead letter exchange if the queue has one.", func(m *jobberMetrics) *int64 { return &m.deadLettered }},
+	}
+	for _, c := range counters {
+		w.header(c.name, "counter", c.help)
+		for _, jb := range jbs {
+			w.sample(c.name, float64(atomic.LoadInt64(c.value(&jb.metrics))), "jobber", jb.name)
+		}
+	}
+
+	w.header("jobber_http_responses_total", "counter", "Responses of the target url by status code, error when the request failed.")
+	for _, jb := range jbs {
+		jb.metrics.lock.Lock()
+		codes := make([]string, 0, len(jb.metrics.codes))
+		for code := range jb.metrics.codes {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			w.sample("jobber_http_responses_total", float64(jb.metrics.codes[code]), "jobber", jb.name, "code", code)
+		}
+		jb.metrics.lock.Unlock()
+	}
+
+	w.header("jobber_request_duration_seconds", "histogram", "Latency of requests to the target url.")
+	for _, jb := range jbs {
+		jb.metrics.lock.Lock()
+		for i, le := range latencyBuckets {
+			var n int64
+			if jb.metrics.buckets != nil {
+				n = jb.metrics.buckets[i]
+			}
+			w.sample("jobber_request_duration_seconds_bucket", float64(n), "jobber", jb.name, "le", strconv.FormatFloat(le, 'g', -1, 64))
+		}
+		w.sample("jobber_request_duration_seconds_bucket", float64(jb.metrics.count), "jobber", jb.name, "le", "+Inf")
+		w.sample("jobber_request_duration_seconds_sum", jb.metrics.sum, "jobber", jb.name)
+		w.sample("jobber_request_duration_seconds_count", float64(jb.metrics.count), "jobber", jb.name)
+		jb.metrics.lock.Unlock()
+	}
+
+	w.header("jobber_workers", "gauge", "Size of the worker pool.")
+	for _, jb := range jbs {
+		size, _ := jb.GetWorkerNum()
+		w.sample("jobber_workers", float64(size), "jobber", jb.name)
+	}
+
+	w.header("jobber_workers_busy", "gauge", "Workers with an in-flight request.")
+	for _, jb := range jbs {
+		_, busy := jb.GetWorkerNum()
+		w.sample("jobber_workers_busy", float64(busy), "jobber", jb.name)
+	}
+
+	w.header("jobber_workers_slow", "gauge", "In-flight requests running longer than the slow threshold.")
+	for _, jb := range jbs {
+		var slow int
+		for _, info := range jb.GetWorkers() {
+			if info.Slow {
+				slow++
+			}
+		}
+		w.sample("jobber_workers_slow", float64(slow), "jobber", jb.name)
+	}
+
+	w.header("jobber_state", "gauge", "Current state of the jobber, 1 for the current state.")
+	for _, jb := range jbs {
+		state := jb.GetState()
+		for s := STOPPED; s <= PAUSED; s++ {
+			var v float64
+			if s == state {
+				v = 1
+			}
+			w.sample("jobber_state", v, "jobber", jb.name, "state", s.String())
+		}
+	}
+
+	// 只输出 inspect_interval 定时刷新缓存的队列状态，抓取指标时不查询 RabbitMQ，
+	// 没有开启定时刷新或者查询失败时没有样本
+	infos := make(map[string]QueueInfo)
+	for _, jb := range jbs {
+		if info, found := jb.cachedQueueInfo(); found && info.Error == "" {
+			infos[jb.name] = info
+		}
+	}
+
+	w.header("jobber_queue_messages", "gauge", "Messages ready in the queue.")
+	for _, jb := range jbs {
+		if info, found := infos[jb.name]; found {
+			w.sample("jobber_queue_messages", float64(info.Messages), "jobber", jb.name, "queue", jb.GetQueueName())
+		}
+	}
+
+	w.header("jobber_queue_consumers", "gauge", "Consumers of the queue.")
+	for _, jb := range jbs {
+		if info, found := infos[jb.name]; found {
+			w.sample("jobber_queue_consumers", float64(info.Consumers), "jobber", jb.name, "queue", jb.GetQueueName())
+		}
+	}
+
+	w.header("jobber_unacked", "gauge", "Deliveries received by the jobber but not acknowledged yet.")
+	for _, jb := range jbs {
+		w.sample("jobber_unacked", float64(atomic.LoadInt64(&jb.unacked)), "jobber", jb.name)
+	}
+
+	conns := Connections.List()
+
+	w.header("jobber_connection_up", "gauge", "Whether the connection to RabbitMQ is established.")
+	for _, c := range conns {
+		status, _ := c.GetStatus()
+		w.sample("jobber_connection_up", float64(status), "connection", strconv.Itoa(c.GetId()), "addr", c.GetAddr())
+	}
+
+	w.header("jobber_connection_reconnects_total", "counter", "Successful reconnects after the first connect.")
+	for _, c := range conns {
+		w.sample("jobber_connection_reconnects_total", float64(c.GetReconnects()), "connection", strconv.Itoa(c.GetId()))
+	}
+
+	return w.buf.Bytes()
+}
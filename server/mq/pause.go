@@ -0,0 +1,153 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Pause 取消订阅(basic.cancel)，已预取的消息继续处理完，保留 channel、队列和统计，until 不为零时到期自动恢复
+func (this *Jobber) Pause(until time.Time) error {
+	if !until.IsZero() && !until.After(time.Now()) {
+		return errors.New(fmt.Sprintf("Pause until %s is in the past", until.Format("2006-01-02 15:04:05")))
+	}
+
+	if err := this.transit(PAUSED, "pause"); err != nil {
+		return err
+	}
+
+	this.cancelConsumers()
+	this.setPauseUntil(until)
+
+	Intents.set(this.name, func(intent *Intent) {
+		intent.Paused = true
+		intent.PauseUntil = until
+	})
+
+	this.getLogger().Infoln("Jobber paused.")
+	return nil
+}
+
+// setPauseUntil 设置暂停到期时间，until 不为零时到期自动恢复
+func (this *Jobber) setPauseUntil(until time.Time) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.pauseUntil = until
+	if this.pauseTimer != nil {
+		this.pauseTimer.Stop()
+		this.pauseTimer = nil
+	}
+	if !until.IsZero() {
+		this.pauseTimer = time.AfterFunc(until.Sub(time.Now()), func() {
+			if err := this.Resume(); err != nil {
+				this.getLogger().Warnln("Jobber auto resume failed: ", err)
+			}
+		})
+	}
+}
+
+// pausedIntent 是否需要恢复手动暂停，已经到期的暂停直接清除
+func (this *Jobber) pausedIntent() (bool, time.Time) {
+	intent, _ := Intents.get(this.name)
+	if !intent.Paused {
+		return false, time.Time{}
+	}
+
+	if !intent.PauseUntil.IsZero() && !intent.PauseUntil.After(time.Now()) {
+		Intents.set(this.name, func(intent *Intent) {
+			intent.Paused = false
+			intent.PauseUntil = time.Time{}
+		})
+		return false, time.Time{}
+	}
+	return true, intent.PauseUntil
+}
+
+// restorePause 启动成功后恢复重启前的手动暂停，启动时没有订阅队列，不需要取消订阅
+func (this *Jobber) restorePause() {
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
+
+	if !this.startPaused {
+		return
+	}
+	this.startPaused = false
+
+	if err := this.transit(PAUSED, "restore pause"); err != nil {
+		this.getLogger().Warnln("Jobber restore pause failed: ", err)
+		return
+	}
+	// 到期时间已过时立即恢复
+	this.setPauseUntil(this.restoreUntil)
+
+	this.getLogger().Infoln("Jobber paused as before restart.")
+}
+
+// Resume 在原来的 channel 上重新订阅队列
+func (this *Jobber) Resume() error {
+	options := this.getOptions()
+
+	// 在 chLock 中转换状态，避免和 scale 重新订阅同时进行
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
+
+	if err := this.transit(RUNNING, "resume"); err != nil {
+		return err
+	}
+	this.clearPause()
+
+	Intents.set(this.name, func(intent *Intent) {
+		intent.Paused = false
+		intent.PauseUntil = time.Time{}
+	})
+
+	for i, channel := range this.channels {
+		if _, err := this.subscribe(this.ctx, i, channel, options); err != nil {
+			// 订阅失败时 broker 会关闭 channel，jobber 随之退出并按 autorestart 处理
+			this.getLogger().Errorln("Jobber resume failed: ", err)
+			return err
+		}
+	}
+
+	this.getLogger().Infoln("Jobber resumed.")
+	return nil
+}
+
+// clearPause 清除暂停到期时间
+func (this *Jobber) clearPause() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.pauseUntil = time.Time{}
+	if this.pauseTimer != nil {
+		this.pauseTimer.Stop()
+		this.pauseTimer = nil
+	}
+}
+
+// GetPauseUntil 获取暂停到期自动恢复的时间，为零表示需要手动恢复
+func (this *Jobber) GetPauseUntil() time.Time {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.pauseUntil
+}
+
+func (this *jobberPools) Pause(name string, until time.Time) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.Pause(until)
+}
+
+func (this *jobberPools) Resume(name string) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.Resume()
+}
@@ -0,0 +1,107 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter 令牌桶限速，rate 为每秒允许的请求数，小于等于 0 时不限速
+type rateLimiter struct {
+	lock   sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		tokens: 1,
+		last:   time.Now(),
+	}
+}
+
+// setRate 运行中修改限速
+func (this *rateLimiter) setRate(rate float64) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.rate = rate
+}
+
+// getRate 获取当前的限速
+func (this *rateLimiter) getRate() float64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.rate
+}
+
+// wait 阻塞直到获得一个令牌，ctx 结束时返回 false
+func (this *rateLimiter) wait(ctx context.Context) bool {
+	for {
+		this.lock.Lock()
+		if this.rate <= 0 {
+			this.lock.Unlock()
+			return true
+		}
+
+		// 桶的容量为 1 秒的令牌数，至少为 1
+		now := time.Now()
+		burst := this.rate
+		if burst < 1 {
+			burst = 1
+		}
+		this.tokens += now.Sub(this.last).Seconds() * this.rate
+		if this.tokens > burst {
+			this.tokens = burst
+		}
+		this.last = now
+
+		if this.tokens >= 1 {
+			this.tokens--
+			this.lock.Unlock()
+			return true
+		}
+
+		wait := time.Duration((1 - this.tokens) / this.rate * float64(time.Second))
+		this.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// SetRateLimit 手动修改限速，为 0 时不限速，配置文件不变，重启和重新读取配置后仍然保持，直到手动清除
+func (this *Jobber) SetRateLimit(rate float64) error {
+	if rate < 0 {
+		return errors.New(fmt.Sprintf("Invalid rate limit %g", rate))
+	}
+
+	this.lock.Lock()
+	this.options.RateLimit = rate
+	this.lock.Unlock()
+	this.limiter.setRate(rate)
+
+	Intents.set(this.name, func(intent *Intent) {
+		intent.RateLimit = &rate
+	})
+
+	this.getLogger().Infof("Jobber rate limit set to %g.", rate)
+	return nil
+}
+
+func (this *jobberPools) SetRateLimit(name string, rate float64) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.SetRateLimit(rate)
+}
@@ -0,0 +1,44 @@
+package mq
+
+import "reflect"
+
+// redacted 获取用于展示和保存的配置，由引用替换得到的字符串值恢复为引用本身，例如 ${secret:name}，
+// 手动调整的线程数和限速等不是字符串的值保持不变
+func (this jobberOptions) redacted() jobberOptions {
+	result := this
+	if this.configFile.raw != nil {
+		redactValue(reflect.ValueOf(&result).Elem(), reflect.ValueOf(*this.configFile.raw))
+	}
+	return result
+}
+
+// redactValue 逐字段把 v 中与 raw 不同的字符串替换为 raw 中的值
+func redactValue(v reflect.Value, raw reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath == "" {
+				redactValue(v.Field(i), raw.Field(i))
+			}
+		}
+	case reflect.String:
+		if v.String() != raw.String() {
+			v.SetString(raw.String())
+		}
+	case reflect.Map:
+		// 只有 headers 这样的 map[string]string，与原配置共享，复制后再修改
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		m := reflect.MakeMap(v.Type())
+		for _, k := range v.MapKeys() {
+			value := v.MapIndex(k)
+			if r := raw.MapIndex(k); r.IsValid() {
+				value = r
+			}
+			m.SetMapIndex(k, value)
+		}
+		v.Set(m)
+	}
+}
@@ -0,0 +1,103 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Scale 调整工作线程数，运行中立即生效，配置文件不变，
+// 调整后的线程数在重启和重新读取配置后仍然保持，直到手动清除，开启了自动调整时会关闭自动调整
+func (this *Jobber) Scale(num int) error {
+	if num <= 0 {
+		return errors.New(fmt.Sprintf("Invalid worker number %d", num))
+	}
+	this.disableAutoscale()
+
+	this.lock.Lock()
+	this.options.WorkerNum = num
+	options := this.options
+	this.lock.Unlock()
+
+	if err := this.applyScale(options); err != nil {
+		return err
+	}
+
+	Intents.set(this.name, func(intent *Intent) {
+		intent.WorkerNum = num
+	})
+
+	this.getLogger().Infof("Jobber scaled to %d workers.", num)
+	return nil
+}
+
+// applyScale 调整线程池大小和 Qos，RabbitMQ 的 Qos 只对之后的订阅生效，所以预取数量变化时需要重新订阅，
+// 取消订阅时已预取的消息仍然会交给工作线程处理，正在处理的请求不受影响，
+// 预取数量不变时(例如配置了 prefetch_count)只调整线程池，不重新订阅
+func (this *Jobber) applyScale(options jobberOptions) error {
+	this.chLock.Lock()
+	defer this.chLock.Unlock()
+
+	if this.workers == nil {
+		return nil
+	}
+	this.workers.resize(this.poolSize(options))
+
+	state := this.GetState()
+	if state != STARTING && state != RUNNING && state != PAUSED {
+		return nil
+	}
+
+	prefetch := this.qosPrefetch(options)
+	if prefetch == this.prefetch {
+		return nil
+	}
+
+	for i, tag := range this.consumerTags {
+		if i >= len(this.channels) {
+			break
+		}
+		channel := this.channels[i]
+
+		if err := channel.Qos(prefetch, options.PrefetchSize, false); err != nil {
+			return err
+		}
+
+		// 暂停中或者启动时需要恢复暂停，不需要重新订阅，恢复时会使用新的 Qos
+		if state == PAUSED || this.startPaused {
+			continue
+		}
+
+		atomic.AddInt32(&this.cancels, 1)
+		if err := channel.Cancel(tag, false); err != nil {
+			return err
+		}
+		if _, err := this.subscribe(this.ctx, i, channel, options); err != nil {
+			return err
+		}
+	}
+
+	this.prefetch = prefetch
+	return nil
+}
+
+// GetWorkerNum 获取工作线程数和正在处理请求的线程数
+func (this *Jobber) GetWorkerNum() (size int, busy int) {
+	this.chLock.Lock()
+	workers := this.workers
+	this.chLock.Unlock()
+
+	if workers == nil {
+		return this.getOptions().WorkerNum, 0
+	}
+	return workers.stat()
+}
+
+func (this *jobberPools) Scale(name string, num int) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.Scale(num)
+}
@@ -0,0 +1,53 @@
+package mq
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	shutdownOnce   sync.Once
+	shutdownNotify = make(chan struct{})
+	shuttingDown   int32
+)
+
+// RequestShutdown 请求关闭服务，由 main 监听 ShutdownNotify 后执行关闭流程
+func RequestShutdown() {
+	shutdownOnce.Do(func() {
+		close(shutdownNotify)
+	})
+}
+
+// ShutdownNotify 收到关闭请求时会被关闭
+func ShutdownNotify() <-chan struct{} {
+	return shutdownNotify
+}
+
+// IsShuttingDown 是否正在关闭
+func IsShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// Shutdown 停止所有 jobber 接收消息，在 timeout 内等待正在处理的请求完成，然后关闭所有连接
+func Shutdown(timeout time.Duration) {
+	atomic.StoreInt32(&shuttingDown, 1)
+	logrus.Infof("Shutting down, drain timeout %s", timeout)
+
+	var wg sync.WaitGroup
+	for _, jb := range Jobbers.List() {
+		wg.Add(1)
+		go func(jb *Jobber) {
+			defer wg.Done()
+			if err := jb.Shutdown(timeout); err != nil {
+				logrus.Warnln(err)
+			}
+		}(jb)
+	}
+	wg.Wait()
+
+	Connections.close()
+	logrus.Info("All jobbers and connections closed.")
+}
@@ -0,0 +1,124 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State jobber 的生命周期状态
+type State int32
+
+const (
+	STOPPED State = iota
+	STARTING
+	RUNNING
+	STOPPING
+	BACKOFF
+	EXITED
+	FATAL
+	PAUSED
+)
+
+const maxTransitions = 50
+
+var stateNames = map[State]string{
+	STOPPED:  "STOPPED",
+	STARTING: "STARTING",
+	RUNNING:  "RUNNING",
+	STOPPING: "STOPPING",
+	BACKOFF:  "BACKOFF",
+	EXITED:   "EXITED",
+	FATAL:    "FATAL",
+	PAUSED:   "PAUSED",
+}
+
+// transitions 每个状态允许转换到的状态
+var transitions = map[State][]State{
+	STOPPED:  {STARTING},
+	EXITED:   {STARTING},
+	FATAL:    {STARTING},
+	STARTING: {RUNNING, BACKOFF, STOPPING, FATAL},
+	RUNNING:  {PAUSED, STOPPING, BACKOFF, EXITED, FATAL},
+	PAUSED:   {RUNNING, STOPPING, BACKOFF, EXITED, FATAL},
+	BACKOFF:  {STARTING, STOPPING, FATAL},
+	STOPPING: {STOPPED},
+}
+
+func (this State) String() string {
+	if name, found := stateNames[this]; found {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// canTransit 是否允许从当前状态转换到 to
+func (this State) canTransit(to State) bool {
+	for _, s := range transitions[this] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition 一次状态转换记录
+type Transition struct {
+	From   State
+	To     State
+	Time   time.Time
+	Reason string
+}
+
+// transit 转换状态，不允许的转换返回错误，成功的转换记录到历史中
+func (this *Jobber) transit(to State, reason string) error {
+	this.stateLock.Lock()
+	defer this.stateLock.Unlock()
+
+	from := this.state
+	if !from.canTransit(to) {
+		return errors.New(fmt.Sprintf("Jobber %s can't transit from %s to %s", this.name, from, to))
+	}
+
+	this.state = to
+	this.history = append(this.history, Transition{
+		From:   from,
+		To:     to,
+		Time:   time.Now(),
+		Reason: reason,
+	})
+	if len(this.history) > maxTransitions {
+		this.history = this.history[len(this.history)-maxTransitions:]
+	}
+
+	return nil
+}
+
+// finish 守护流程结束时转换到最终状态，如果期间已经被停止则转换为 STOPPED
+func (this *Jobber) finish(to State, reason string) {
+	if err := this.transit(to, reason); err == nil {
+		return
+	}
+
+	if err := this.transit(STOPPED, "stopped"); err != nil {
+		this.getLogger().Errorln(err)
+	}
+}
+
+// GetState 获取当前状态
+func (this *Jobber) GetState() State {
+	this.stateLock.Lock()
+	defer this.stateLock.Unlock()
+
+	return this.state
+}
+
+// GetHistory 获取状态转换历史
+func (this *Jobber) GetHistory() []Transition {
+	this.stateLock.Lock()
+	defer this.stateLock.Unlock()
+
+	list := make([]Transition, len(this.history))
+	copy(list, this.history)
+	return list
+}
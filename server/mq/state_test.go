@@ -0,0 +1,42 @@
+package mq
+
+import "testing"
+
+func TestStateCanTransit(t *testing.T) {
+	cases := []struct {
+		from State
+		to   State
+		ok   bool
+	}{
+		{STOPPED, STARTING, true},
+		{STOPPED, RUNNING, false},
+		{STOPPED, STOPPING, false},
+		{STARTING, RUNNING, true},
+		{STARTING, BACKOFF, true},
+		{STARTING, STOPPING, true},
+		{STARTING, FATAL, true},
+		{STARTING, PAUSED, false},
+		{RUNNING, PAUSED, true},
+		{RUNNING, EXITED, true},
+		{RUNNING, STARTING, false},
+		{RUNNING, STOPPED, false},
+		{PAUSED, RUNNING, true},
+		{PAUSED, STOPPING, true},
+		{PAUSED, STARTING, false},
+		{BACKOFF, STARTING, true},
+		{BACKOFF, RUNNING, false},
+		{STOPPING, STOPPED, true},
+		{STOPPING, STARTING, false},
+		{EXITED, STARTING, true},
+		{EXITED, STOPPED, false},
+		{FATAL, STARTING, true},
+		{FATAL, RUNNING, false},
+		{State(99), STARTING, false},
+	}
+
+	for _, c := range cases {
+		if ok := c.from.canTransit(c.to); ok != c.ok {
+			t.Errorf("%s -> %s: canTransit = %t, want %t", c.from, c.to, ok, c.ok)
+		}
+	}
+}
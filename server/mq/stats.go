@@ -0,0 +1,179 @@
+package mq
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// statsTick 滑动平均速率的更新间隔
+	statsTick = 5 * time.Second
+
+	// statsSamples 计算延迟分位数保留的最近请求数
+	statsSamples = 1024
+)
+
+// ewma 指数加权的滑动平均速率，与 load average 的算法一致
+type ewma struct {
+	alpha float64
+	rate  float64
+	init  bool
+}
+
+func newEwma(window time.Duration) ewma {
+	return ewma{alpha: 1 - math.Exp(-statsTick.Seconds()/window.Seconds())}
+}
+
+func (this *ewma) tick(count int64) {
+	rate := float64(count) / statsTick.Seconds()
+	if !this.init {
+		this.rate = rate
+		this.init = true
+		return
+	}
+	this.rate += this.alpha * (rate - this.rate)
+}
+
+// jobberStats jobber 处理请求的统计，jobber 重启后不清零
+type jobberStats struct {
+	lock      sync.Mutex
+	processed int64
+	failed    int64
+
+	pending  int64 // 当前更新间隔内处理的请求数
+	lastTick time.Time
+	rates    [3]ewma // 1 分钟、5 分钟、15 分钟
+
+	samples []time.Duration // 最近的请求延迟，环形缓冲
+	next    int
+
+	lastError       string
+	lastErrorTime   time.Time
+	lastSuccessTime time.Time
+}
+
+// Stats 统计的快照
+type Stats struct {
+	Processed       int64
+	Failed          int64
+	SuccessRate     float64 // 成功的比例，0 到 1，没有请求时为 0
+	Rate1m          float64 // 每秒处理的请求数
+	Rate5m          float64
+	Rate15m         float64
+	P50             time.Duration
+	P95             time.Duration
+	P99             time.Duration
+	LastError       string
+	LastErrorTime   time.Time
+	LastSuccessTime time.Time
+}
+
+// tick 按经过的时间更新滑动平均速率，lock 由调用方持有
+func (this *jobberStats) tick(now time.Time) {
+	if this.lastTick.IsZero() {
+		this.rates = [3]ewma{newEwma(time.Minute), newEwma(5 * time.Minute), newEwma(15 * time.Minute)}
+		this.lastTick = now
+		return
+	}
+
+	for n := 0; now.Sub(this.lastTick) >= statsTick; n++ {
+		// 长时间没有请求时速率已经衰减到 0，不需要逐个间隔计算
+		if n > 1000 {
+			for i := range this.rates {
+				this.rates[i].rate = 0
+			}
+			this.lastTick = now
+			break
+		}
+
+		for i := range this.rates {
+			this.rates[i].tick(this.pending)
+		}
+		this.pending = 0
+		this.lastTick = this.lastTick.Add(statsTick)
+	}
+}
+
+// record 记录一次请求的结果，errMsg 为空表示成功
+func (this *jobberStats) record(d time.Duration, errMsg string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := time.Now()
+	this.tick(now)
+
+	this.processed++
+	this.pending++
+	if errMsg != "" {
+		this.failed++
+		this.lastError = errMsg
+		this.lastErrorTime = now
+	} else {
+		this.lastSuccessTime = now
+	}
+
+	if len(this.samples) < statsSamples {
+		this.samples = append(this.samples, d)
+	} else {
+		this.samples[this.next] = d
+		this.next = (this.next + 1) % statsSamples
+	}
+}
+
+// snapshot 获取统计的快照
+func (this *jobberStats) snapshot() Stats {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.tick(time.Now())
+
+	stats := Stats{
+		Processed:       this.processed,
+		Failed:          this.failed,
+		Rate1m:          this.rates[0].rate,
+		Rate5m:          this.rates[1].rate,
+		Rate15m:         this.rates[2].rate,
+		LastError:       this.lastError,
+		LastErrorTime:   this.lastErrorTime,
+		LastSuccessTime: this.lastSuccessTime,
+	}
+	if this.processed > 0 {
+		stats.SuccessRate = float64(this.processed-this.failed) / float64(this.processed)
+	}
+
+	if len(this.samples) > 0 {
+		sorted := append([]time.Duration{}, this.samples...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		stats.P50 = percentile(sorted, 0.50)
+		stats.P95 = percentile(sorted, 0.95)
+		stats.P99 = percentile(sorted, 0.99)
+	}
+	return stats
+}
+
+// percentile 获取已排序延迟的分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// GetStats 获取 jobber 处理请求的统计
+func (this *Jobber) GetStats() Stats {
+	return this.stats.snapshot()
+}
+
+// GetUptime 获取本次启动以来运行的时间，没有运行时为 0
+func (this *Jobber) GetUptime() time.Duration {
+	state := this.GetState()
+	if state != RUNNING && state != PAUSED {
+		return 0
+	}
+	return time.Since(this.GetStartTime())
+}
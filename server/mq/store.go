@@ -0,0 +1,230 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	jobberName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+	// storeLock 保证通过 api 修改配置文件时不会并发写入
+	storeLock sync.Mutex
+)
+
+// jobberFile 新建 jobber 时配置文件的路径，位于第一个 include 所在目录，
+// 扩展名与 include 一致，include 没有指定扩展名时为 .yaml
+func jobberFile(name string) (string, error) {
+	if !jobberName.MatchString(name) || name == "." || name == ".." {
+		return "", errors.New(fmt.Sprintf("Invalid jobber name %s", name))
+	}
+
+	patterns, err := includePatterns()
+	if err != nil {
+		return "", err
+	}
+	includePath := patterns[0]
+
+	ext := filepath.Ext(includePath)
+	if formats[strings.ToLower(ext)] != FORMAT_YAML {
+		ext = ".yaml"
+	}
+
+	file := filepath.Join(filepath.Dir(includePath), name+ext)
+	if !includeMatch(file) {
+		return "", errors.New(fmt.Sprintf("Config file %s does not match include %s", file, includePath))
+	}
+	return file, nil
+}
+
+// editable 通过 api 修改的 jobber 必须定义在配置文件中
+func editable(name string, file string) error {
+	if isInline(file) {
+		return errors.New(fmt.Sprintf("Jobber %s is defined in the jobbers list of %s, edit it there", name, viper.ConfigFileUsed()))
+	}
+	return nil
+}
+
+// writeFile 先写入同目录下的临时文件再重命名，避免 reread 读到写了一半的配置
+func writeFile(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// check 写入前校验配置，新的配置不能让原本有效的其他配置文件失效，例如 jobber 名称重复
+func (this *jobberPools) check(name string, file string, content []byte) error {
+	before, err := Validate(nil)
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[string]bool)
+	for _, report := range before {
+		valid[report.File] = report.Valid()
+	}
+
+	after, err := Validate(map[string][]byte{file: content})
+	if err != nil {
+		return err
+	}
+
+	for _, report := range after {
+		if report.File != file {
+			if valid[report.File] && !report.Valid() {
+				return errors.New(fmt.Sprintf("Config conflicts with %s: %s", report.File, report.Error()))
+			}
+			continue
+		}
+
+		if !report.Valid() {
+			return errors.New(report.Error())
+		}
+		if report.Name != name {
+			return errors.New(fmt.Sprintf("Jobber name %s in config does not match %s", report.Name, name))
+		}
+	}
+	return nil
+}
+
+// apply 重新读取配置后只应用 name 对应 jobber 的变化，其他配置文件的变化留给 reread 和 update 处理，
+// reread 和应用在同一个锁内完成，不会被 watcher 或其他请求打断
+func (this *jobberPools) apply(name string, source string) ([]UpdateResult, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, _, _, err := this.reread(); err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]jobberOptions)
+	if op, found := this.changed[name]; found {
+		changed[name] = op
+		delete(this.changed, name)
+	}
+
+	removed := make([]string, 0)
+	others := make([]string, 0, len(this.removed))
+	for _, v := range this.removed {
+		if v == name {
+			removed = append(removed, v)
+		} else {
+			others = append(others, v)
+		}
+	}
+	this.removed = others
+
+	return this.applyChanges(changed, removed, source, 0), nil
+}
+
+// ReadFile 获取 jobber 的配置文件路径和内容
+func (this *jobberPools) ReadFile(name string) (string, []byte, error) {
+	jb, err := this.get(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	file := jb.getOptions().configFile.filePath
+	if err := editable(name, file); err != nil {
+		return "", nil, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	return file, content, err
+}
+
+// Create 校验配置后在 include 目录下新建配置文件并应用
+func (this *jobberPools) Create(name string, content []byte, source string) ([]UpdateResult, error) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	if _, err := this.get(name); err == nil {
+		return nil, errors.New(fmt.Sprintf("Jobber %s already exists", name))
+	}
+
+	file, err := jobberFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(file); err == nil {
+		return nil, errors.New(fmt.Sprintf("Config file %s already exists", file))
+	}
+
+	if err := this.check(name, file, content); err != nil {
+		return nil, err
+	}
+	if err := writeFile(file, content); err != nil {
+		return nil, err
+	}
+
+	return this.apply(name, source)
+}
+
+// Replace 校验配置后覆盖 jobber 的配置文件并应用
+func (this *jobberPools) Replace(name string, content []byte, source string) ([]UpdateResult, error) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	jb, err := this.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file := jb.getOptions().configFile.filePath
+	if err := editable(name, file); err != nil {
+		return nil, err
+	}
+	if err := this.check(name, file, content); err != nil {
+		return nil, err
+	}
+	if err := writeFile(file, content); err != nil {
+		return nil, err
+	}
+
+	return this.apply(name, source)
+}
+
+// Delete 删除 jobber 的配置文件，jobber 在应用时停止并移除
+func (this *jobberPools) Delete(name string, source string) ([]UpdateResult, error) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	jb, err := this.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file := jb.getOptions().configFile.filePath
+	if err := editable(name, file); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(file); err != nil {
+		return nil, err
+	}
+
+	return this.apply(name, source)
+}
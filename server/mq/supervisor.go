@@ -0,0 +1,136 @@
+package mq
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	AUTORESTART_ALWAYS     = "always"
+	AUTORESTART_UNEXPECTED = "unexpected"
+	AUTORESTART_NEVER      = "never"
+)
+
+// Start 启动 Jobber 并守护，退出后按照 autorestart 策略自动重启
+func (this *Jobber) Start() {
+	this.lock.Lock()
+	if this.supervising {
+		this.lock.Unlock()
+		this.getLogger().Warnln("Jobber is always running,can't start again.")
+		return
+	}
+
+	if err := this.transit(STARTING, "start"); err != nil {
+		this.lock.Unlock()
+		this.getLogger().Warnln(err)
+		return
+	}
+
+	ctx, cancle := context.WithCancel(context.Background())
+	this.supervising = true
+	this.stopping = false
+	this.superCancle = cancle
+	this.closeNotifies = make([]chan bool, 0)
+	this.lock.Unlock()
+
+	defer func() {
+		if err := recover(); err != nil {
+			switch err.(type) {
+			case error:
+				logrus.Errorln(err)
+			}
+			this.finish(FATAL, "panic")
+		}
+
+		this.lock.Lock()
+		this.supervising = false
+		notifies := this.closeNotifies
+		this.closeNotifies = nil
+		this.lock.Unlock()
+		cancle()
+
+		// 通知所有需要得知当前 Jobber 退出情况的监听者
+		for _, c := range notifies {
+			close(c)
+		}
+		logrus.Infof("Jobber: %s exits", this.name)
+	}()
+
+	options := this.getOptions()
+	retry := newBackoff(time.Duration(options.Backoff)*time.Second, time.Minute, 0.2)
+	retries := 0
+	for {
+		options = this.getOptions()
+		started, err := this.run(ctx, options)
+
+		reason := "exited"
+		if err != nil {
+			reason = err.Error()
+		}
+
+		if this.isStopping() {
+			this.finish(STOPPED, "stopped")
+			return
+		}
+
+		// 连接断开时不消耗重试次数，等待重连成功后由连接重新启动
+		if atomic.LoadInt32(&this.conn.status) == 0 {
+			this.finish(FATAL, "connection lost")
+			this.getLogger().Warnln("Connection lost, wait for reconnecting.")
+			return
+		}
+
+		if started {
+			retries = 0
+			retry.reset()
+
+			expected := err == nil
+			if options.Autorestart == AUTORESTART_NEVER || (options.Autorestart == AUTORESTART_UNEXPECTED && expected) {
+				this.finish(EXITED, reason)
+				return
+			}
+		} else {
+			retries++
+			if retries > options.StartRetries {
+				this.finish(FATAL, reason)
+				this.getLogger().Errorf("Jobber gave up after %d start retries.", options.StartRetries)
+				return
+			}
+		}
+
+		// backoff 为 0 时立即重启
+		var wait time.Duration
+		if options.Backoff > 0 {
+			wait = retry.next()
+		}
+		if this.transit(BACKOFF, reason) != nil {
+			// 在转换前被停止
+			this.finish(STOPPED, "stopped")
+			return
+		}
+		this.getLogger().Warnf("Jobber will restart in %s", wait)
+
+		select {
+		case <-ctx.Done():
+			this.finish(STOPPED, "stopped")
+			return
+		case <-time.After(wait):
+		}
+
+		if this.transit(STARTING, "restart") != nil {
+			this.finish(STOPPED, "stopped")
+			return
+		}
+	}
+}
+
+// isStopping 是否被主动停止
+func (this *Jobber) isStopping() bool {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.stopping
+}
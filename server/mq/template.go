@@ -0,0 +1,168 @@
+package mq
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"gitlab.mydadao.com/marketing/message_jobber/config"
+	"gopkg.in/yaml.v2"
+)
+
+// expandError 配置中的引用替换失败，field 为字段的路径
+type expandError struct {
+	field string
+	err   error
+}
+
+func (this *expandError) Error() string {
+	return this.field + ": " + this.err.Error()
+}
+
+// normalize 把 yaml 和 viper 解析出的 map 统一为 map[string]interface{}，expand 为 true 时替换字符串中的引用，
+// 只替换解析后的字符串值，引用的值中包含的换行、引号和注释符号不会改变配置的结构
+func normalize(v interface{}, path string, expand bool) (interface{}, error) {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			key := fmt.Sprintf("%v", k)
+			n, err := normalize(item, fieldPath(path, key), expand)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = n
+		}
+		return m, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			n, err := normalize(item, fieldPath(path, k), expand)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = n
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, 0, len(val))
+		for i, item := range val {
+			n, err := normalize(item, fmt.Sprintf("%s[%d]", path, i), expand)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, n)
+		}
+		return list, nil
+	case string:
+		if !expand {
+			return val, nil
+		}
+		s, err := config.Expand(val)
+		if err != nil {
+			return nil, &expandError{field: path, err: err}
+		}
+		return s, nil
+	}
+	return v, nil
+}
+
+func fieldPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// normalizeMap 获取 map 类型的配置，不是 map 时返回空的 map
+func normalizeMap(v interface{}, expand bool) (map[string]interface{}, error) {
+	n, err := normalize(v, "", expand)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := n.(map[string]interface{})
+	if !ok {
+		return make(map[string]interface{}), nil
+	}
+	return m, nil
+}
+
+// merge 深度合并，src 中的字段覆盖 dst，两边都是 map 时递归合并，不修改 dst 和 src
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		result[k] = v
+	}
+
+	for k, v := range src {
+		d, dok := result[k].(map[string]interface{})
+		s, sok := v.(map[string]interface{})
+		if dok && sok {
+			result[k] = merge(d, s)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// inherited 获取 jobber 继承的配置：jobber.yaml 中的 defaults，以及 extends 指定的模板，
+// 模板也可以通过 extends 继承其他模板，越靠近 jobber 的模板优先级越高
+func inherited(extends string, expand bool) (map[string]interface{}, error) {
+	base, err := normalizeMap(viper.Get("defaults"), expand)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid defaults: %s", err.Error()))
+	}
+	if extends == "" {
+		return base, nil
+	}
+
+	templates, err := normalizeMap(viper.Get("templates"), expand)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid templates: %s", err.Error()))
+	}
+
+	chain := make([]map[string]interface{}, 0)
+	seen := make(map[string]bool)
+	for name := extends; name != ""; {
+		if seen[name] {
+			return nil, errors.New(fmt.Sprintf("Template %s extends itself", name))
+		}
+		seen[name] = true
+
+		t, found := templates[name].(map[string]interface{})
+		if !found {
+			return nil, errors.New(fmt.Sprintf("Not found template %s", name))
+		}
+		chain = append(chain, t)
+		name, _ = t["extends"].(string)
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		base = merge(base, chain[i])
+	}
+	delete(base, "extends")
+	return base, nil
+}
+
+// inherit 把继承的配置合并到配置文件中，返回合并后的内容，expand 为 true 时替换配置文件和继承的配置中的引用
+func inherit(content []byte, expand bool) (merged []byte, err error) {
+	var raw interface{}
+	if err = yaml.Unmarshal(content, &raw); err != nil {
+		return
+	}
+
+	file, err := normalizeMap(raw, expand)
+	if err != nil {
+		return
+	}
+
+	extends, _ := file["extends"].(string)
+	base, err := inherited(extends, expand)
+	if err != nil {
+		return
+	}
+
+	merged, err = yaml.Marshal(merge(base, file))
+	return
+}
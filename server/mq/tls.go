@@ -0,0 +1,91 @@
+package mq
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+type tlsOptions struct {
+	Enable     bool
+	CaFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	SkipVerify bool
+	External   bool
+
+	config *tls.Config
+}
+
+// load 根据配置加载证书，生成 amqps 连接使用的 tls.Config
+func (this *tlsOptions) load() error {
+	this.config = nil
+	if !this.Enable {
+		if this.External {
+			return errors.New("EXTERNAL auth requires server.rabbitmq.tls.enable")
+		}
+		return nil
+	}
+
+	cfg := &tls.Config{
+		ServerName:         this.ServerName,
+		InsecureSkipVerify: this.SkipVerify,
+	}
+
+	if this.CaFile != "" {
+		ca, err := ioutil.ReadFile(this.CaFile)
+		if err != nil {
+			return err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return errors.New(fmt.Sprintf("No valid certificate found in CA bundle %s", this.CaFile))
+		}
+	}
+
+	if this.CertFile != "" || this.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(this.CertFile, this.KeyFile)
+		if err != nil {
+			return err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if this.External && len(cfg.Certificates) == 0 {
+		return errors.New("EXTERNAL auth requires a client certificate")
+	}
+
+	this.config = cfg
+	return nil
+}
+
+// scheme 返回连接 broker 时使用的协议
+func (this *tlsOptions) scheme() string {
+	if this.Enable {
+		return "amqps"
+	}
+	return "amqp"
+}
+
+// clientConfig 每次拨号都返回一份拷贝，amqp.DialConfig 会改写其中的 ServerName
+func (this *tlsOptions) clientConfig() *tls.Config {
+	if this.config == nil {
+		return nil
+	}
+	return this.config.Clone()
+}
+
+// externalAuth SASL EXTERNAL 认证，身份由客户端证书确定
+type externalAuth struct{}
+
+func (this *externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (this *externalAuth) Response() string {
+	return ""
+}
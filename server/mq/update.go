@@ -0,0 +1,155 @@
+package mq
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	UPDATE_ADDED     = "added"
+	UPDATE_REMOVED   = "removed"
+	UPDATE_HOT       = "updated"
+	UPDATE_RESTARTED = "restarted"
+	UPDATE_UNCHANGED = "unchanged"
+	UPDATE_FAILED    = "failed"
+)
+
+// hotFields 不需要重启 jobber 就可以生效的配置
+var hotFields = map[string]bool{
+	"group":          true,
+	"url":            true,
+	"headers":        true,
+	"ratelimit":      true,
+	"timeout":        true,
+	"slow_threshold": true,
+	"log":            true,
+	"autostart":      true,
+	"autorestart":    true,
+	"startretries":   true,
+	"startsecs":      true,
+	"backoff":        true,
+	"workernum":      true,
+	"prefetch_count": true,
+	"autoscale":      true,
+}
+
+// UpdateResult 一个 jobber 的更新结果
+type UpdateResult struct {
+	Name   string
+	Action string
+	Fields []string
+	Error  string
+}
+
+// optionKey 获取配置字段在配置文件中的名称
+func optionKey(field reflect.StructField) string {
+	if tag := field.Tag.Get("yaml"); tag != "" {
+		return strings.Split(tag, ",")[0]
+	}
+	return strings.ToLower(field.Name)
+}
+
+// diffOptions 比较新旧配置，返回发生变化的字段
+func diffOptions(old, new jobberOptions) []string {
+	fields := make([]string, 0)
+
+	t := reflect.TypeOf(old)
+	ov := reflect.ValueOf(old)
+	nv := reflect.ValueOf(new)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			fields = append(fields, optionKey(field))
+		}
+	}
+
+	return fields
+}
+
+// needRestart 变化的字段中是否有需要重启才能生效的
+func needRestart(fields []string) bool {
+	for _, f := range fields {
+		if !hotFields[f] {
+			return true
+		}
+	}
+	return false
+}
+
+// setOptions 替换配置，日志配置变化时重建日志，工作线程数变化时调整线程池
+func (this *Jobber) setOptions(options jobberOptions) {
+	this.lock.Lock()
+	old := this.options
+	this.options = options
+
+	var oldLogger *logger
+	if old.Log != options.Log {
+		oldLogger = this.logger
+		this.logger = NewLogger(options.Log.Path, options.Log.Maxsize)
+	}
+	this.lock.Unlock()
+
+	this.limiter.setRate(options.RateLimit)
+
+	if old.WorkerNum != options.WorkerNum || old.PrefetchCount != options.PrefetchCount || old.Autoscale != options.Autoscale {
+		if err := this.applyScale(options); err != nil {
+			this.getLogger().Errorln("Jobber scale failed: ", err)
+		}
+	}
+
+	// 正在处理的请求可能还持有旧的日志，不主动关闭，只刷新缓冲
+	if oldLogger != nil {
+		oldLogger._log.Sync()
+	}
+}
+
+// update 应用新的配置，可以热更新的字段直接生效，
+// 其他字段变化时先平滑停止 jobber，更新配置后重新声明队列并启动
+func (this *Jobber) update(options jobberOptions) UpdateResult {
+	result := UpdateResult{
+		Name: this.name,
+	}
+
+	if err := validateOptions(options); err != nil {
+		result.Action = UPDATE_FAILED
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Fields = diffOptions(this.getOptions(), options)
+	if len(result.Fields) == 0 {
+		this.setOptions(options)
+		result.Action = UPDATE_UNCHANGED
+		return result
+	}
+
+	if !needRestart(result.Fields) {
+		this.setOptions(options)
+		result.Action = UPDATE_HOT
+		this.getLogger().Infof("Jobber options updated: %s", strings.Join(result.Fields, ", "))
+		return result
+	}
+
+	running := this.IsActive()
+	if running {
+		c := make(chan bool)
+		<-this.Stop(c)
+	}
+
+	this.setOptions(options)
+	if !running {
+		result.Action = UPDATE_HOT
+		this.getLogger().Infof("Jobber options updated: %s", strings.Join(result.Fields, ", "))
+		return result
+	}
+
+	result.Action = UPDATE_RESTARTED
+	this.getLogger().Infof("Jobber options updated, restart for: %s", strings.Join(result.Fields, ", "))
+	go this.Start()
+
+	return result
+}
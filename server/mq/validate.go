@@ -0,0 +1,403 @@
+package mq
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Issue 配置文件中的一个问题
+type Issue struct {
+	Line    int // 行号，为 0 时无法定位
+	Field   string
+	Message string
+}
+
+// FileReport 一个配置文件的校验结果
+type FileReport struct {
+	File   string
+	Name   string
+	Issues []Issue
+
+	format  string
+	content []byte
+	options jobberOptions
+}
+
+// Valid 配置文件是否可以应用
+func (this FileReport) Valid() bool {
+	return len(this.Issues) == 0
+}
+
+// Error 把所有问题合并为一条错误信息
+func (this FileReport) Error() string {
+	list := make([]string, 0, len(this.Issues))
+	for _, issue := range this.Issues {
+		if issue.Line > 0 {
+			list = append(list, fmt.Sprintf("line %d: %s", issue.Line, issue.Message))
+		} else {
+			list = append(list, issue.Message)
+		}
+	}
+	return strings.Join(list, "; ")
+}
+
+func (this *FileReport) add(field string, message string) {
+	this.Issues = append(this.Issues, Issue{
+		Line:    fieldLine(this.format, this.content, field),
+		Field:   field,
+		Message: message,
+	})
+}
+
+// optionIssues 校验 jobber 的配置，Field 为配置文件中的字段路径
+func optionIssues(options jobberOptions) []Issue {
+	issues := make([]Issue, 0)
+	add := func(field string, message string) {
+		issues = append(issues, Issue{Field: field, Message: message})
+	}
+
+	if options.Name == "" {
+		add("name", "Missing jobber's name")
+	}
+
+	if options.Queue.Name == "" {
+		add("queue.name", "Missing queue's name")
+	}
+
+	if options.Exchange.Name == "" {
+		add("exchange.name", "Missing exchange's name")
+	}
+
+	if options.Exchange.Etype == "" {
+		add("exchange.type", "Missing exchange's type")
+	} else if options.Exchange.Etype != DIRECT && options.Exchange.Etype != FANOUT {
+		add("exchange.type", "Exchange's type is not valid")
+	}
+
+	if options.WorkerNum <= 0 {
+		add("workernum", "Workernum must be greater than 0")
+	}
+
+	if options.TargetUrl == "" {
+		add("url", "Missing url")
+	} else if u, err := url.Parse(options.TargetUrl); err != nil {
+		add("url", fmt.Sprintf("Url is not valid: %s", err.Error()))
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("url", "Url must be an absolute http or https url")
+	}
+
+	if options.SlowThreshold < 0 {
+		add("slow_threshold", "Slow threshold must not be negative")
+	}
+
+	if options.Log.Path == "" {
+		add("log.path", "Missing log path")
+	}
+
+	switch options.Autorestart {
+	case "", AUTORESTART_ALWAYS, AUTORESTART_UNEXPECTED, AUTORESTART_NEVER:
+	default:
+		add("autorestart", "Autorestart is not valid")
+	}
+
+	if options.Channels <= 0 {
+		add("channels", "Channels must be greater than 0")
+	}
+
+	if options.StartRetries < 0 {
+		add("startretries", "Startretries must not be negative")
+	}
+
+	if options.StartSecs < 0 {
+		add("startsecs", "Startsecs must not be negative")
+	}
+
+	if options.Backoff < 0 {
+		add("backoff", "Backoff must not be negative")
+	}
+
+	if options.Autoscale.Enable {
+		if options.Autoscale.Min <= 0 || options.Autoscale.Max < options.Autoscale.Min {
+			add("autoscale.min", "Autoscale's min and max are not valid")
+		}
+
+		if options.Autoscale.TargetLatency <= 0 {
+			add("autoscale.target_latency", "Missing autoscale's target latency")
+		}
+
+		if options.Autoscale.Interval <= 0 {
+			add("autoscale.interval", "Autoscale's interval must be greater than 0")
+		}
+	}
+
+	return issues
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+// yamlIssues 把 yaml 的错误拆分为带行号的问题
+func yamlIssues(err error) []Issue {
+	var messages []string
+	if e, ok := err.(*yaml.TypeError); ok {
+		messages = e.Errors
+	} else {
+		messages = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	issues := make([]Issue, 0, len(messages))
+	for _, msg := range messages {
+		issue := Issue{Message: msg}
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			issue.Line, _ = strconv.Atoi(m[1])
+			issue.Message = m[2]
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// withoutLines 去掉无法对应到配置文件的行号
+func withoutLines(issues []Issue) []Issue {
+	for i := range issues {
+		issues[i].Line = 0
+	}
+	return issues
+}
+
+// keyLine 查找字段在配置文件中的行号，例如 exchange.type，
+// 字段不存在时返回最近的上级字段所在行，都不存在时返回 0
+func keyLine(content []byte, path string) int {
+	keys := strings.Split(path, ".")
+	lines := strings.Split(string(content), "\n")
+
+	found, depth, indent := 0, 0, -1
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		n := len(line) - len(trimmed)
+		if depth > 0 && n <= indent {
+			// 已经离开上级字段的范围
+			break
+		}
+		if depth == 0 && n != 0 {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, keys[depth]+":") {
+			continue
+		}
+
+		found = i + 1
+		if depth == len(keys)-1 {
+			break
+		}
+		depth++
+		indent = n
+	}
+
+	return found
+}
+
+// parseOptions 严格解析配置，未知的字段和类型不匹配都会报错，
+// 默认值在解析前填充，配置中显式写的 0 (例如 startretries: 0 不重试)不会被默认值覆盖
+func parseOptions(content []byte) (options jobberOptions, err error) {
+	options.Channels = 1
+	options.StartRetries = 3
+	options.Backoff = 1
+	options.Autoscale.Interval = 5
+
+	err = yaml.UnmarshalStrict(content, &options)
+	if err != nil {
+		return
+	}
+
+	// 没有配置分组时，jobber 自成一组
+	if options.Group == "" {
+		options.Group = options.Name
+	}
+
+	if options.Autorestart == "" {
+		options.Autorestart = AUTORESTART_UNEXPECTED
+	}
+
+	return
+}
+
+// validateContent 解析并校验一个配置文件的内容
+func validateContent(file string, content []byte) FileReport {
+	report := FileReport{
+		File:    file,
+		Issues:  make([]Issue, 0),
+		format:  fileFormat(file),
+		content: content,
+	}
+
+	if report.format == "" {
+		report.Issues = append(report.Issues, Issue{Message: fmt.Sprintf("Unsupported config format %s", filepath.Ext(file))})
+		return report
+	}
+
+	data, err := toYaml(report.format, content)
+	if err != nil {
+		report.Issues = append(report.Issues, tomlIssues(err)...)
+		return report
+	}
+
+	// 先单独严格解析配置文件，yaml 和 json 错误的行号与配置文件一致，toml 转换后行号无法对应
+	if err = yaml.UnmarshalStrict(data, &jobberOptions{}); err != nil {
+		if report.format == FORMAT_TOML || report.format == FORMAT_INLINE {
+			report.Issues = append(report.Issues, withoutLines(yamlIssues(err))...)
+		} else {
+			report.Issues = append(report.Issues, yamlIssues(err)...)
+		}
+		return report
+	}
+
+	// 替换环境变量和 secret 引用，合并 defaults 和模板后再解析一次，模板中的错误无法定位到行
+	merged, err := inherit(data, true)
+	if err != nil {
+		if e, ok := err.(*expandError); ok {
+			report.add(e.field, e.err.Error())
+		} else {
+			report.add("extends", err.Error())
+		}
+		return report
+	}
+
+	options, err := parseOptions(merged)
+	if err != nil {
+		for _, issue := range yamlIssues(err) {
+			report.add("extends", "Invalid defaults or template: "+issue.Message)
+		}
+		return report
+	}
+	options.configFile.hash = optionsHash(options)
+
+	// 没有替换引用的配置，用于展示和保存历史，引用的环境变量和 secret 不会泄露
+	rawMerged, err := inherit(data, false)
+	if err == nil {
+		var raw jobberOptions
+		if raw, err = parseOptions(rawMerged); err == nil {
+			options.configFile.raw = &raw
+		}
+	}
+	if err != nil {
+		report.add("extends", "References are only supported in string values: "+err.Error())
+		return report
+	}
+
+	report.Name = options.Name
+	report.options = options
+	for _, issue := range optionIssues(options) {
+		report.add(issue.Field, issue.Message)
+	}
+	return report
+}
+
+// validateFiles 校验多个配置文件以及文件之间重复的 jobber 名称、队列/消费者组合和声明不一致的 exchange，
+// jobber 名称重复时无法确定以哪个为准，所有定义了该名称的配置都无效，
+// contents 中的内容会替换同名文件，不存在的文件作为新文件校验
+func validateFiles(files []string, contents map[string][]byte) []FileReport {
+	list := make([]string, 0, len(files)+len(contents))
+	list = append(list, files...)
+	for file := range contents {
+		exists := false
+		for _, f := range files {
+			if f == file {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, file)
+		}
+	}
+	sort.Strings(list)
+
+	reports := make([]FileReport, 0, len(list))
+	names := make(map[string]int)
+	consumers := make(map[string]string)
+	exchanges := make(map[string]int)
+	for _, file := range list {
+		content, found := contents[file]
+		if !found {
+			var err error
+			content, err = ioutil.ReadFile(file)
+			if err != nil {
+				reports = append(reports, FileReport{
+					File:   file,
+					Issues: []Issue{{Message: err.Error()}},
+				})
+				continue
+			}
+		}
+
+		report := validateContent(file, content)
+		if report.Name != "" {
+			if i, found := names[report.Name]; found {
+				other := &reports[i]
+				report.add("name", fmt.Sprintf("Duplicate jobber name %s, also defined in %s", report.Name, other.File))
+				other.add("name", fmt.Sprintf("Duplicate jobber name %s, also defined in %s", report.Name, file))
+			} else {
+				names[report.Name] = len(reports)
+			}
+
+			// 同一个 exchange 的类型或者 durable 不一致时，后声明的会被 RabbitMQ 拒绝(406 PRECONDITION_FAILED)
+			exchange := report.options.Exchange
+			if i, found := exchanges[exchange.Name]; found && exchange.Name != "" {
+				other := reports[i].options.Exchange
+				if exchange.Etype != other.Etype || exchange.Durable != other.Durable {
+					report.add("exchange", fmt.Sprintf("Exchange %s is declared as type %s durable %t, but as type %s durable %t in %s",
+						exchange.Name, exchange.Etype, exchange.Durable, other.Etype, other.Durable, reports[i].File))
+				}
+			} else {
+				exchanges[exchange.Name] = len(reports)
+			}
+
+			key := report.options.Queue.Name + "/" + report.options.Consumer
+			if other, found := consumers[key]; found && report.options.Queue.Name != "" {
+				report.add("consumer", fmt.Sprintf("Duplicate consumer %s of queue %s, also defined in %s", report.options.Consumer, report.options.Queue.Name, other))
+			} else {
+				consumers[key] = file
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	for _, report := range reports {
+		issues := report.Issues
+		sort.SliceStable(issues, func(i, j int) bool {
+			return issues[i].Line < issues[j].Line
+		})
+	}
+	return reports
+}
+
+// Validate 校验 include 下的所有配置文件以及 jobbers 列表里的 jobber，不会应用任何配置，
+// contents 中的内容会替换同名文件或者作为新文件一起校验
+func Validate(contents map[string][]byte) ([]FileReport, error) {
+	files, err := includeFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	inline, err := inlineJobbers()
+	if err != nil {
+		return nil, err
+	}
+	for file, content := range contents {
+		inline[file] = content
+	}
+
+	return validateFiles(files, inline), nil
+}
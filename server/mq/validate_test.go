@@ -0,0 +1,187 @@
+package mq
+
+import (
+	"strings"
+	"testing"
+)
+
+const validYaml = `name: goldbean
+queue:
+  name: goldbean.start
+exchange:
+  name: order.start
+  type: fanout
+consumer: xiangzhi
+workernum: 4
+url: "http://127.0.0.1:8082/index.php"
+log:
+  path: /tmp/goldbean.log
+`
+
+// jobberYaml 生成一个有效的 yaml 配置，按需替换名称、队列、消费者和 exchange
+func jobberYaml(name, queue, consumer, exchange, etype string) string {
+	r := strings.NewReplacer(
+		"name: goldbean\n", "name: "+name+"\n",
+		"name: goldbean.start", "name: "+queue,
+		"consumer: xiangzhi", "consumer: "+consumer,
+		"name: order.start", "name: "+exchange,
+		"type: fanout", "type: "+etype,
+	)
+	return r.Replace(validYaml)
+}
+
+func TestValidateContentLines(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		line    int
+		message string
+	}{
+		{"valid yaml", "a.yaml", validYaml, -1, ""},
+		{"unknown field", "a.yaml", validYaml + "unknown: 1\n", 12, "field unknown not found"},
+		{"type mismatch", "a.yaml", strings.Replace(validYaml, "workernum: 4", "workernum: four", 1), 8, "cannot unmarshal"},
+		{"nested unknown field", "a.yaml", strings.Replace(validYaml, "  type: fanout", "  type: fanout\n  kind: x", 1), 7, "field kind not found"},
+		{"missing field", "a.yaml", strings.Replace(validYaml, "workernum: 4\n", "", 1), 0, "Workernum must be greater than 0"},
+		{"invalid nested value", "a.yaml", strings.Replace(validYaml, "type: fanout", "type: topic", 1), 6, "Exchange's type is not valid"},
+		{"negative backoff", "a.yaml", validYaml + "backoff: -1\n", 12, "Backoff must not be negative"},
+		{"zero channels", "a.yaml", validYaml + "channels: 0\n", 12, "Channels must be greater than 0"},
+		{"json unknown field", "a.json", "{\n  \"name\": \"a\",\n  \"unknown\": 1\n}\n", 3, "field unknown not found"},
+		{"json invalid value", "a.json", "{\n  \"name\": \"a\",\n  \"queue\": {\n    \"name\": \"q\"\n  },\n  \"exchange\": {\n    \"name\": \"e\",\n    \"type\": \"topic\"\n  },\n  \"workernum\": 1,\n  \"url\": \"http://a\",\n  \"log\": {\"path\": \"/tmp/a.log\"}\n}\n", 8, "Exchange's type is not valid"},
+		{"unsupported format", "a.ini", "name = a", 0, "Unsupported config format .ini"},
+	}
+
+	for _, c := range cases {
+		report := validateContent(c.file, []byte(c.content))
+		if c.line < 0 {
+			if !report.Valid() {
+				t.Errorf("%s: expected valid, got %s", c.name, report.Error())
+			}
+			continue
+		}
+
+		found := false
+		for _, issue := range report.Issues {
+			if strings.Contains(issue.Message, c.message) {
+				found = true
+				if issue.Line != c.line {
+					t.Errorf("%s: issue %q at line %d, want %d", c.name, issue.Message, issue.Line, c.line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: expected issue %q, got %s", c.name, c.message, report.Error())
+		}
+	}
+}
+
+func TestKeyLine(t *testing.T) {
+	content := []byte(`# comment
+name: a
+queue:
+  # nested comment
+  name: q
+  durable: true
+exchange:
+  name: e
+`)
+
+	cases := []struct {
+		path string
+		line int
+	}{
+		{"name", 2},
+		{"queue", 3},
+		{"queue.name", 5},
+		{"queue.durable", 6},
+		{"exchange.name", 8},
+		{"exchange.type", 7},
+		{"log.path", 0},
+	}
+
+	for _, c := range cases {
+		if line := keyLine(content, c.path); line != c.line {
+			t.Errorf("keyLine(%s) = %d, want %d", c.path, line, c.line)
+		}
+	}
+}
+
+func TestValidateFilesConflicts(t *testing.T) {
+	cases := []struct {
+		name    string
+		files   map[string]string
+		invalid map[string]string // 无效的文件及其包含的错误信息
+	}{
+		{
+			name: "distinct",
+			files: map[string]string{
+				"a.yaml": jobberYaml("a", "qa", "c", "e", "fanout"),
+				"b.yaml": jobberYaml("b", "qb", "c", "e", "fanout"),
+			},
+		},
+		{
+			name: "duplicate name",
+			files: map[string]string{
+				"a.yaml": jobberYaml("a", "qa", "c", "e", "fanout"),
+				"b.yaml": jobberYaml("a", "qb", "c", "e", "fanout"),
+			},
+			invalid: map[string]string{
+				"a.yaml": "Duplicate jobber name a, also defined in b.yaml",
+				"b.yaml": "Duplicate jobber name a, also defined in a.yaml",
+			},
+		},
+		{
+			name: "duplicate consumer",
+			files: map[string]string{
+				"a.yaml": jobberYaml("a", "q", "c", "e", "fanout"),
+				"b.yaml": jobberYaml("b", "q", "c", "e", "fanout"),
+			},
+			invalid: map[string]string{
+				"b.yaml": "Duplicate consumer c of queue q, also defined in a.yaml",
+			},
+		},
+		{
+			name: "same queue different consumer",
+			files: map[string]string{
+				"a.yaml": jobberYaml("a", "q", "c1", "e", "fanout"),
+				"b.yaml": jobberYaml("b", "q", "c2", "e", "fanout"),
+			},
+		},
+		{
+			name: "conflicting exchange",
+			files: map[string]string{
+				"a.yaml": jobberYaml("a", "qa", "c", "e", "fanout"),
+				"b.yaml": jobberYaml("b", "qb", "c", "e", "direct"),
+			},
+			invalid: map[string]string{
+				"b.yaml": "Exchange e is declared as type direct durable false, but as type fanout durable false in a.yaml",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		contents := make(map[string][]byte)
+		for file, content := range c.files {
+			contents[file] = []byte(content)
+		}
+
+		reports := validateFiles(nil, contents)
+		if len(reports) != len(c.files) {
+			t.Errorf("%s: got %d reports, want %d", c.name, len(reports), len(c.files))
+			continue
+		}
+
+		for _, report := range reports {
+			message, invalid := c.invalid[report.File]
+			if !invalid {
+				if !report.Valid() {
+					t.Errorf("%s: %s expected valid, got %s", c.name, report.File, report.Error())
+				}
+				continue
+			}
+			if !strings.Contains(report.Error(), message) {
+				t.Errorf("%s: %s expected %q, got %q", c.name, report.File, message, report.Error())
+			}
+		}
+	}
+}
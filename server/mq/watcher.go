@@ -0,0 +1,113 @@
+package mq
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	EVENT_CONFIG = "config"
+
+	SOURCE_WATCH = "watch"
+)
+
+// watchInclude 监控 include 目录，文件变化后等待 debounce 时间没有新的变化，自动执行 reread 和 update
+func watchInclude(ctx context.Context, debounce time.Duration) error {
+	patterns, err := includePatterns()
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+	for _, pattern := range patterns {
+		dir := filepath.Dir(pattern)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+		logrus.Infof("Watching jobber config directory %s", dir)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !includeMatch(e.Name) {
+					continue
+				}
+
+				logrus.Debugf("Jobber config file changed: %s", e.String())
+				timer = time.After(debounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Errorf("Watch jobber config directory failed with error: %s", err.Error())
+			case <-timer:
+				timer = nil
+				autoUpdate()
+			}
+		}
+	}()
+
+	return nil
+}
+
+// autoUpdate 配置文件变化后自动更新，无效的配置文件不会被应用
+func autoUpdate() {
+	changes, removes, invalids, err := Jobbers.Reread()
+	if err != nil {
+		logrus.Errorf("Auto reread jobber config failed with error: %s", err.Error())
+		Events.Add(EVENT_CONFIG, SOURCE_WATCH, "", fmt.Sprintf("reread failed: %s", err.Error()))
+		return
+	}
+
+	for file, e := range invalids {
+		logrus.Errorf("Refuse to apply invalid jobber config %s: %s", file, e)
+		Events.Add(EVENT_CONFIG, SOURCE_WATCH, "", fmt.Sprintf("refused invalid config %s: %s", file, e))
+	}
+
+	if len(changes) == 0 && len(removes) == 0 {
+		return
+	}
+
+	for _, r := range Jobbers.Update(SOURCE_WATCH) {
+		msg := r.Action
+		if len(r.Fields) > 0 {
+			msg += ": " + strings.Join(r.Fields, ", ")
+		}
+
+		if r.Error != "" {
+			msg += ": " + r.Error
+			logrus.Errorf("Auto update jobber %s %s", r.Name, msg)
+		} else {
+			logrus.Infof("Auto update jobber %s %s", r.Name, msg)
+		}
+		Events.Add(EVENT_CONFIG, SOURCE_WATCH, r.Name, msg)
+	}
+}
@@ -0,0 +1,217 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// previewSize 工作线程信息中消息内容预览的最大字节数
+const previewSize = 100
+
+// workerTask 工作线程正在处理的请求
+type workerTask struct {
+	deliveryTag uint64
+	messageId   string
+	body        []byte
+	target      string
+	start       time.Time
+	cancel      context.CancelFunc
+	canceled    bool
+}
+
+// WorkerInfo 工作线程正在处理的请求的快照
+type WorkerInfo struct {
+	Id          int
+	DeliveryTag uint64
+	MessageId   string
+	Preview     string
+	Target      string
+	Start       time.Time
+	Elapsed     time.Duration
+	Slow        bool // 处理时间超过了 slow_threshold
+	Canceled    bool
+}
+
+// workerPool 可以在运行中调整大小的工作线程池，每个工作线程用一个编号表示
+type workerPool struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	size  int
+	busy  map[int]bool
+	tasks map[int]*workerTask
+	peak  int // 上次 resetPeak 之后同时忙碌的最大数量
+}
+
+func newWorkerPool(size int) *workerPool {
+	pool := &workerPool{
+		size:  size,
+		busy:  make(map[int]bool),
+		tasks: make(map[int]*workerTask),
+	}
+	pool.cond = sync.NewCond(&pool.lock)
+	return pool
+}
+
+// acquire 获取一个空闲的工作线程，没有空闲时阻塞
+func (this *workerPool) acquire() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for len(this.busy) >= this.size {
+		this.cond.Wait()
+	}
+
+	// 忙碌的数量小于 size，所以一定能在 [0, size) 中找到空闲的编号
+	i := 0
+	for this.busy[i] {
+		i++
+	}
+	this.busy[i] = true
+	if len(this.busy) > this.peak {
+		this.peak = len(this.busy)
+	}
+	return i
+}
+
+// release 归还工作线程
+func (this *workerPool) release(i int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	delete(this.busy, i)
+	delete(this.tasks, i)
+	this.cond.Broadcast()
+}
+
+// resize 调整线程池大小，缩小时正在处理的请求不受影响，处理完后不再分配超出的线程
+func (this *workerPool) resize(size int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.size = size
+	this.cond.Broadcast()
+}
+
+// wait 等待所有工作线程空闲
+func (this *workerPool) wait() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for len(this.busy) > 0 {
+		this.cond.Wait()
+	}
+}
+
+// stat 获取线程池大小和忙碌的数量
+func (this *workerPool) stat() (size int, busy int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return this.size, len(this.busy)
+}
+
+// resetPeak 返回并重置同时忙碌的最大数量
+func (this *workerPool) resetPeak() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	peak := this.peak
+	this.peak = len(this.busy)
+	return peak
+}
+
+// begin 记录工作线程开始处理的请求
+func (this *workerPool) begin(i int, task *workerTask) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.tasks[i] = task
+}
+
+// canceled 工作线程正在处理的请求是否被手动取消
+func (this *workerPool) canceled(i int) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	task, found := this.tasks[i]
+	return found && task.canceled
+}
+
+// cancel 取消工作线程正在处理的请求
+func (this *workerPool) cancel(i int) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	task, found := this.tasks[i]
+	if !found {
+		return errors.New(fmt.Sprintf("Worker %d is idle", i))
+	}
+
+	task.canceled = true
+	task.cancel()
+	return nil
+}
+
+// list 获取所有正在处理的请求，按工作线程编号排序，slow 为慢请求的阈值
+func (this *workerPool) list(slow time.Duration) []WorkerInfo {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	now := time.Now()
+	infos := make([]WorkerInfo, 0, len(this.tasks))
+	for i, task := range this.tasks {
+		elapsed := now.Sub(task.start)
+		infos = append(infos, WorkerInfo{
+			Id:          i,
+			DeliveryTag: task.deliveryTag,
+			MessageId:   task.messageId,
+			Preview:     preview(task.body, previewSize),
+			Target:      task.target,
+			Start:       task.start,
+			Elapsed:     elapsed,
+			Slow:        elapsed > slow,
+			Canceled:    task.canceled,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Id < infos[j].Id
+	})
+	return infos
+}
+
+// preview 截取消息内容的前 n 个字节，不截断多字节字符
+func preview(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+
+	for n > 0 && !utf8.RuneStart(body[n]) {
+		n--
+	}
+	return string(body[:n]) + "..."
+}
+
+// Workers 获取 jobber 正在处理请求的工作线程
+func (this *jobberPools) Workers(name string) ([]WorkerInfo, error) {
+	jb, err := this.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return jb.GetWorkers(), nil
+}
+
+// CancelWorker 取消 jobber 的工作线程正在处理的请求
+func (this *jobberPools) CancelWorker(name string, id int) error {
+	jb, err := this.get(name)
+	if err != nil {
+		return err
+	}
+
+	return jb.CancelWorker(id)
+}
@@ -26,6 +26,7 @@ func Load(g *gin.Engine, mw ...gin.HandlerFunc) *gin.Engine {
 	})
 
 	g.GET("/", new(handlers.Home).Index)
+	g.GET("/metrics", new(handlers.Metrics).Index)
 
 	mq := g.Group("/mq")
 	{
@@ -36,7 +37,37 @@ func Load(g *gin.Engine, mw ...gin.HandlerFunc) *gin.Engine {
 		mq.GET("/remove", mqHandler.Remove)
 		mq.GET("/reread", mqHandler.Reread)
 		mq.GET("/update", mqHandler.Update)
+		mq.GET("/reload", mqHandler.Reload)
 		mq.GET("/restart", mqHandler.Restart)
+		mq.GET("/pause", mqHandler.Pause)
+		mq.GET("/resume", mqHandler.Resume)
+		mq.GET("/scale", mqHandler.Scale)
+		mq.GET("/autoscale", mqHandler.Autoscale)
+		mq.GET("/ratelimit", mqHandler.RateLimit)
+		mq.GET("/clear", mqHandler.Clear)
+		mq.GET("/history", mqHandler.History)
+		mq.GET("/brokers", mqHandler.Brokers)
+		mq.GET("/events", mqHandler.Events)
+		mq.POST("/shutdown", mqHandler.Shutdown)
+		mq.POST("/validate", mqHandler.Validate)
+	}
+
+	jobbers := g.Group("/jobbers")
+	{
+		jobbersHandler := new(handlers.Jobbers)
+		jobbers.GET("/:name", jobbersHandler.Get)
+		jobbers.POST("/:name", jobbersHandler.Create)
+		jobbers.PUT("/:name", jobbersHandler.Replace)
+		jobbers.DELETE("/:name", jobbersHandler.Delete)
+		jobbers.GET("/:name/workers", jobbersHandler.Workers)
+		jobbers.DELETE("/:name/workers/:id", jobbersHandler.CancelWorker)
+	}
+
+	config := g.Group("/config")
+	{
+		configHandler := new(handlers.Config)
+		config.GET("/history", configHandler.History)
+		config.POST("/rollback", configHandler.Rollback)
 	}
 	return g
 }